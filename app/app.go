@@ -3,14 +3,22 @@ package app
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"sanyuktgolang/domain"
-	"sanyuktgolang/logger"
-	"sanyuktgolang/service"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/domain"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+	"github.com/harishkokcha91/sanyuktgolang/service"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	_ "github.com/go-sql-driver/mysql"
+	"google.golang.org/grpc"
 
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
@@ -19,17 +27,92 @@ import (
 func Start() {
 	sanityCheck()
 	router := mux.NewRouter()
-	authRepository := domain.NewAuthRepository(getDbClient())
-	ah := AuthHandler{service.NewLoginService(authRepository, domain.GetRolePermissions())}
+	dbClient := getDbClient()
+	clientIpHeader = os.Getenv("CLIENT_IP_HEADER")
+	if proxies := os.Getenv("CLIENT_IP_TRUSTED_PROXIES"); proxies != "" {
+		n, err := strconv.Atoi(proxies)
+		if err != nil || n < 1 {
+			panic("CLIENT_IP_TRUSTED_PROXIES must be a positive number")
+		}
+		trustedProxies = n
+	}
+	debugDecisions = os.Getenv("AUTHZ_DEBUG") == "true"
+	if cookie := os.Getenv("FORWARD_AUTH_COOKIE"); cookie != "" {
+		forwardAuthCookie = cookie
+	}
+	rateLimitStore := getRateLimitStore(dbClient)
+	otpPolicy := getOtpPolicy()
+	otpHasher := getOtpHasher()
+	authRepository := domain.NewAuthRepository(dbClient, otpPolicy, otpHasher)
+	keyCipher := getSigningKeyCipher()
+	applyMigrations(dbClient, otpHasher)
+	keyService := getKeyService(domain.NewKeyRepository(dbClient, keyCipher))
+	tokenService := domain.NewJwtTokenService(keyService.KeyRing(), getIssuer())
+	denylist := domain.NewTokenDenylist(dbClient)
+	rateLimiter := domain.NewRateLimiter(rateLimitStore, getRateLimits())
+	lockoutRepository := domain.NewAccountLockoutRepository(dbClient, getLockoutPolicy())
+	mfaRepository := domain.NewMfaRepository(dbClient, getSecretCipher())
+	webAuthnRepository := domain.NewWebAuthnRepository(dbClient)
+	passkeys := getWebAuthnRelyingParty(webAuthnRepository)
+	routes := getRouteMap()
+	roleService := getRoleService(domain.NewRoleRepository(dbClient), routes)
+	clientRepository := domain.NewClientRepository(dbClient)
+	authService := service.NewLoginService(authRepository, roleService.Permissions(), getPolicies(), tokenService, tokenService, denylist,
+		getPasswordHasher(), getOtpNotifier(otpPolicy.TTL), rateLimiter, lockoutRepository, mfaRepository, passkeys, clientRepository)
+	ah := AuthHandler{authService}
+	mh := MfaHandler{service.NewMfaService(authService, mfaRepository, getMfaIssuerName())}
+	wh := WebAuthnHandler{service.NewWebAuthnService(authService, authRepository, rateLimiter, passkeys)}
+	codeRepository := domain.NewAuthorizationCodeRepository(dbClient)
+	oh := OAuthHandler{service.NewOAuthService(authService, authRepository, tokenService, tokenService, clientRepository, keyService.KeyRing(), codeRepository)}
+	kh := KeyHandler{keyService}
+	rh := RoleHandler{roleService}
+	ph := PolicyHandler{service.NewPolicyService(authService)}
+	fh := ForwardAuthHandler{authService, routes}
 
 	router.HandleFunc("/auth/generateotp", ah.GenerateOtp).Methods(http.MethodPost)
 	router.HandleFunc("/auth/verifyotp", ah.VerifyOtp).Methods(http.MethodPost)
 	router.HandleFunc("/auth/login", ah.Login).Methods(http.MethodPost)
-	router.HandleFunc("/auth/register", ah.NotImplementedHandler).Methods(http.MethodPost)
+	router.HandleFunc("/auth/register", ah.Register).Methods(http.MethodPost)
 	router.HandleFunc("/auth/refresh", ah.Refresh).Methods(http.MethodPost)
 	router.HandleFunc("/auth/verify", ah.Verify).Methods(http.MethodGet)
+	router.HandleFunc("/auth/forward", fh.Authorize)
+	router.HandleFunc("/auth/revoke", ah.Revoke).Methods(http.MethodPost)
+	router.HandleFunc("/auth/mfa/totp/enroll", mh.EnrollTotp).Methods(http.MethodPost)
+	router.HandleFunc("/auth/mfa/totp/confirm", mh.ConfirmTotp).Methods(http.MethodPost)
+	router.HandleFunc("/auth/mfa/verify", mh.Verify).Methods(http.MethodPost)
+	router.HandleFunc("/auth/mfa/webauthn/begin", wh.BeginSecondFactor).Methods(http.MethodPost)
+	router.HandleFunc("/auth/webauthn/register/begin", wh.BeginRegistration).Methods(http.MethodPost)
+	router.HandleFunc("/auth/webauthn/register/finish", wh.FinishRegistration).Methods(http.MethodPost)
+	router.HandleFunc("/auth/webauthn/login/begin", wh.BeginLogin).Methods(http.MethodPost)
+	router.HandleFunc("/auth/webauthn/login/finish", wh.FinishLogin).Methods(http.MethodPost)
+	router.HandleFunc("/oauth/introspect", oh.Introspect).Methods(http.MethodPost)
+	router.HandleFunc("/oauth/authorize", oh.Authorize).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/oauth/token", oh.Token).Methods(http.MethodPost)
+	router.HandleFunc("/.well-known/openid-configuration", oh.Discovery).Methods(http.MethodGet)
+	router.HandleFunc("/userinfo", oh.UserInfo).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/.well-known/jwks.json", kh.Jwks).Methods(http.MethodGet)
+	router.HandleFunc("/auth/keys/rotate", ah.requirePermission("RotateSigningKeys", kh.Rotate)).Methods(http.MethodPost)
+	router.HandleFunc("/auth/roles", ah.requirePermission("ManageRoles", rh.FindAll)).Methods(http.MethodGet)
+	router.HandleFunc("/auth/roles/reload", ah.requirePermission("ManageRoles", rh.Reload)).Methods(http.MethodPost)
+	router.HandleFunc("/auth/roles/{role}", ah.requirePermission("ManageRoles", rh.Find)).Methods(http.MethodGet)
+	router.HandleFunc("/auth/roles/{role}", ah.requirePermission("ManageRoles", rh.Save)).Methods(http.MethodPut)
+	router.HandleFunc("/auth/roles/{role}", ah.requirePermission("ManageRoles", rh.Delete)).Methods(http.MethodDelete)
+	router.HandleFunc("/auth/policy/evaluate", ah.requirePermission("EvaluatePolicies", ph.Evaluate)).Methods(http.MethodPost)
+	router.HandleFunc("/auth/accounts/{user_id:[0-9]+}/unlock", ah.requirePermission("UnlockAccounts", ah.UnlockAccount)).Methods(http.MethodPost)
+
+	go func() {
+		for range time.Tick(time.Hour) {
+			denylist.DeleteExpired()
+			authRepository.DeleteExpiredRegistrations()
+			rateLimitStore.DeleteExpired()
+			webAuthnRepository.DeleteExpiredChallenges()
+		}
+	}()
 
 	address := os.Getenv("SERVER_ADDRESS")
+	if grpcPort := os.Getenv("EXT_AUTHZ_GRPC_PORT"); grpcPort != "" {
+		startExtAuthzServer(fmt.Sprintf("%s:%s", address, grpcPort), ExtAuthzServer{service: authService, routes: routes})
+	}
 	port := os.Getenv("SERVER_PORT")
 	logger.Info(fmt.Sprintf("Starting OAuth server on %s:%s ...", address, port))
 	log.Fatal(http.ListenAndServe(fmt.Sprintf("%s:%s", address, port), router))
@@ -42,7 +125,7 @@ func getDbClient() *sqlx.DB {
 	dbPort := os.Getenv("DB_PORT")
 	dbName := os.Getenv("DB_NAME")
 
-	dataSource := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", dbUser, dbPasswd, dbAddr, dbPort, dbName)
+	dataSource := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", dbUser, dbPasswd, dbAddr, dbPort, dbName)
 	client, err := sqlx.Open("mysql", dataSource)
 	if err != nil {
 		panic(err)
@@ -54,6 +137,380 @@ func getDbClient() *sqlx.DB {
 	return client
 }
 
+/*
+getSigner builds the initial token signer from the environment, it is only
+used when the signing_keys table is still empty. JWT_SIGNING_ALG defaults to
+HS256. JWT_SIGNING_KEY_FILE holds the HMAC secret, or for RS*, PS*, ES* and
+EdDSA the PEM encoded private key; without it a random key is generated.
+JWT_KEY_ID overrides the derived key id of a key read from the file.
+*/
+func getSigner() domain.Signer {
+	alg := os.Getenv("JWT_SIGNING_ALG")
+	if alg == "" {
+		alg = "HS256"
+	}
+	kid := os.Getenv("JWT_KEY_ID")
+	keyFile := os.Getenv("JWT_SIGNING_KEY_FILE")
+
+	var signer domain.Signer
+	var err error
+	if keyFile == "" {
+		signer, err = domain.GenerateSigner(alg)
+	} else if strings.HasPrefix(alg, "HS") {
+		var secret []byte
+		if secret, err = os.ReadFile(keyFile); err != nil {
+			panic(err)
+		}
+		signer, err = domain.NewHMACSigner(kid, alg, secret)
+	} else {
+		var pemBytes []byte
+		if pemBytes, err = os.ReadFile(keyFile); err != nil {
+			panic(err)
+		}
+		signer, err = domain.NewSignerFromPEM(kid, alg, pemBytes)
+	}
+	if err != nil {
+		panic(err)
+	}
+	return signer
+}
+
+/*
+getKeyService loads the signing key ring. Retired keys verify tokens as long
+as the tokens they signed can be valid, after that JWT_MAX_RETIRED_KEYS
+(default 2) of them are kept.
+JWT_KEY_RELOAD_INTERVAL (default "1m") is how often keys rotated by other
+instances are picked up and JWT_KEY_ROTATION_INTERVAL, e.g. "720h", enables
+scheduled rotation.
+*/
+func getKeyService(repo domain.KeyRepository) service.DefaultKeyService {
+	maxRetired := 2
+	if v := os.Getenv("JWT_MAX_RETIRED_KEYS"); v != "" {
+		var err error
+		if maxRetired, err = strconv.Atoi(v); err != nil {
+			panic(err)
+		}
+		if maxRetired < 0 {
+			panic(fmt.Sprintf("JWT_MAX_RETIRED_KEYS must not be negative, got %d", maxRetired))
+		}
+	}
+	keyService, appErr := service.NewKeyService(repo, domain.NewKeyRing(getSigner()), maxRetired)
+	if appErr != nil {
+		panic(appErr.Message)
+	}
+	active := keyService.KeyRing().Signer()
+	logger.Info(fmt.Sprintf("Signing tokens with %s key %s", active.Method().Alg(), active.Kid()))
+	reloadInterval := time.Minute
+	if v := os.Getenv("JWT_KEY_RELOAD_INTERVAL"); v != "" {
+		var err error
+		if reloadInterval, err = time.ParseDuration(v); err != nil {
+			panic(err)
+		}
+	}
+	keyService.ScheduleReload(reloadInterval)
+	if v := os.Getenv("JWT_KEY_ROTATION_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			panic(err)
+		}
+		keyService.ScheduleRotation(interval, time.Minute)
+	}
+	return keyService
+}
+
+// getSigningKeyCipher encrypts the private signing keys in the database with
+// JWT_KEY_ENCRYPTION_KEY. Changing the key makes the stored keys unusable.
+func getSigningKeyCipher() domain.SecretCipher {
+	key := os.Getenv("JWT_KEY_ENCRYPTION_KEY")
+	if key == "" {
+		panic("JWT_KEY_ENCRYPTION_KEY not defined")
+	}
+	cipher, err := domain.NewSecretCipher([]byte(key))
+	if err != nil {
+		panic(err)
+	}
+	return cipher
+}
+
+// applyMigrations brings the data of existing installs up to date, once.
+func applyMigrations(client *sqlx.DB, otpHasher domain.OtpHasher) {
+	migrations := []domain.Migration{
+		domain.HashPlaintextOtps(otpHasher),
+	}
+	if appErr := domain.NewMigrationRepository(client).Apply(migrations); appErr != nil {
+		panic(appErr.Message)
+	}
+}
+
+// getRoleService loads the role permissions, ROLE_RELOAD_INTERVAL (default
+// "1m") is how often changes made elsewhere are picked up. Permissions can be
+// granted for the routes of the route map.
+func getRoleService(repo domain.RoleRepository, routes *domain.RouteMap) service.DefaultRoleService {
+	roleService, appErr := service.NewRoleService(repo, routes.RouteNames())
+	if appErr != nil {
+		panic(appErr.Message)
+	}
+	interval := time.Minute
+	if v := os.Getenv("ROLE_RELOAD_INTERVAL"); v != "" {
+		var err error
+		if interval, err = time.ParseDuration(v); err != nil {
+			panic(err)
+		}
+	}
+	roleService.ScheduleReload(interval)
+	return roleService
+}
+
+// getPolicies loads the attribute based policies of /auth/verify from the
+// JSON file POLICY_FILE, by default customers may only access their own
+// resources.
+func getPolicies() *authz.PolicySet {
+	path := os.Getenv("POLICY_FILE")
+	if path == "" {
+		return authz.DefaultPolicies()
+	}
+	policies, err := authz.LoadPolicies(path)
+	if err != nil {
+		panic(err)
+	}
+	logger.Info(fmt.Sprintf("Loaded %d policies from %s", len(policies.Policies), path))
+	return policies
+}
+
+// getRouteMap loads the route mappings of the Envoy external authorization
+// server and of /auth/forward from the JSON file ROUTE_MAP_FILE, by default
+// the banking API routes. They also name the routes of the protected API
+// roles can be granted, so routes only checked through /auth/verify have to
+// be mapped too.
+func getRouteMap() *domain.RouteMap {
+	path := os.Getenv("ROUTE_MAP_FILE")
+	if path == "" {
+		return domain.DefaultRouteMap()
+	}
+	routes, err := domain.LoadRouteMap(path)
+	if err != nil {
+		panic(err)
+	}
+	return routes
+}
+
+// startExtAuthzServer serves the Envoy external authorization API over gRPC,
+// enabled by setting EXT_AUTHZ_GRPC_PORT.
+func startExtAuthzServer(address string, server ExtAuthzServer) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		panic(err)
+	}
+	grpcServer := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(grpcServer, server)
+	logger.Info(fmt.Sprintf("Starting Envoy external authorization server on %s ...", address))
+	go func() {
+		log.Fatal(grpcServer.Serve(listener))
+	}()
+}
+
+// getOtpPolicy reads OTP_TTL, e.g. "10m", and OTP_MAX_ATTEMPTS, defaulting to
+// 5 minutes and 5 attempts.
+func getOtpPolicy() domain.OtpPolicy {
+	policy := domain.NewOtpPolicy()
+	if v := os.Getenv("OTP_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			panic(err)
+		}
+		policy.TTL = ttl
+	}
+	if v := os.Getenv("OTP_MAX_ATTEMPTS"); v != "" {
+		maxAttempts, err := strconv.Atoi(v)
+		if err != nil {
+			panic(err)
+		}
+		policy.MaxAttempts = maxAttempts
+	}
+	return policy
+}
+
+// getOtpHasher keys the OTP hashes with OTP_PEPPER. Changing the pepper
+// invalidates the codes issued so far, which only live for the OTP TTL.
+func getOtpHasher() domain.OtpHasher {
+	pepper := os.Getenv("OTP_PEPPER")
+	if pepper == "" {
+		panic("OTP_PEPPER not defined")
+	}
+	return domain.NewOtpHasher([]byte(pepper))
+}
+
+/*
+getOtpNotifier selects the OTP channel with OTP_CHANNEL, which is required so
+a deployment never writes codes to its logs by accident:
+
+	sms    posts to the HTTP gateway OTP_SMS_GATEWAY_URL with OTP_SMS_API_KEY,
+	       sending as OTP_SMS_FROM
+	email  sends through the SMTP server SMTP_ADDR (host:port) as SMTP_FROM,
+	       authenticating with SMTP_USERNAME and SMTP_PASSWORD when set
+	file   appends the messages to OTP_FILE, for development
+	log    logs the messages, for development
+
+OTP_TEMPLATE_DIR holds <locale>.tmpl message templates adding to or replacing
+the built in ones.
+*/
+func getOtpNotifier(ttl time.Duration) domain.OtpNotifier {
+	var sender domain.OtpSender
+	switch channel := os.Getenv("OTP_CHANNEL"); channel {
+	case domain.OtpChannelSms:
+		sender = domain.NewSmsOtpSender(os.Getenv("OTP_SMS_GATEWAY_URL"), os.Getenv("OTP_SMS_API_KEY"), os.Getenv("OTP_SMS_FROM"))
+	case domain.OtpChannelEmail:
+		sender = domain.NewEmailOtpSender(os.Getenv("SMTP_ADDR"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("SMTP_FROM"))
+	case domain.OtpChannelFile:
+		sender = domain.NewDevOtpSender(os.Getenv("OTP_FILE"))
+	case domain.OtpChannelLog:
+		sender = domain.NewDevOtpSender("")
+	case "":
+		panic("OTP_CHANNEL not defined")
+	default:
+		panic(fmt.Sprintf("unsupported OTP channel %s", channel))
+	}
+	if sender.Channel() != domain.OtpChannelSms && sender.Channel() != domain.OtpChannelEmail {
+		logger.Warn(fmt.Sprintf("OTPs are written to the %s, use the sms or email channel in production", sender.Channel()))
+	}
+	templates, err := domain.NewOtpTemplates(os.Getenv("OTP_TEMPLATE_DIR"))
+	if err != nil {
+		panic(err)
+	}
+	return domain.NewOtpNotifier(sender, templates, ttl)
+}
+
+// getRateLimitStore keeps the rate limit counters in memory, or with
+// RATE_LIMIT_STORE=db in the database so all instances share them.
+func getRateLimitStore(client *sqlx.DB) domain.RateLimitStore {
+	switch store := os.Getenv("RATE_LIMIT_STORE"); store {
+	case "", "memory":
+		return domain.NewMemoryRateLimitStore()
+	case "db":
+		return domain.NewRateLimitStore(client)
+	default:
+		panic(fmt.Sprintf("unsupported rate limit store %s", store))
+	}
+}
+
+// getRateLimits overrides the default limits with RATE_LIMIT_<NAME>, e.g.
+// RATE_LIMIT_OTP_RESEND="1/2m" for a two minute resend cool-down.
+func getRateLimits() map[string]domain.RateLimit {
+	limits := domain.DefaultRateLimits()
+	for name := range limits {
+		if v := os.Getenv("RATE_LIMIT_" + strings.ToUpper(name)); v != "" {
+			limit, err := domain.ParseRateLimit(v)
+			if err != nil {
+				panic(err)
+			}
+			limits[name] = limit
+		}
+	}
+	return limits
+}
+
+// getLockoutPolicy reads LOGIN_BACKOFF_AFTER, LOGIN_LOCK_AFTER and
+// LOGIN_LOCK_DURATION, e.g. "1h", overriding the defaults of 3, 10 and 30
+// minutes.
+func getLockoutPolicy() domain.LockoutPolicy {
+	policy := domain.NewLockoutPolicy()
+	for env, value := range map[string]*int{"LOGIN_BACKOFF_AFTER": &policy.BackoffAfter, "LOGIN_LOCK_AFTER": &policy.LockAfter} {
+		if v := os.Getenv(env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				panic(err)
+			}
+			*value = n
+		}
+	}
+	if v := os.Getenv("LOGIN_LOCK_DURATION"); v != "" {
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			panic(err)
+		}
+		policy.LockDuration = duration
+	}
+	return policy
+}
+
+// getSecretCipher encrypts the TOTP secrets with MFA_SECRET_KEY. Changing the
+// key makes the enrolled authenticators unusable.
+func getSecretCipher() domain.SecretCipher {
+	key := os.Getenv("MFA_SECRET_KEY")
+	if key == "" {
+		panic("MFA_SECRET_KEY not defined")
+	}
+	cipher, err := domain.NewSecretCipher([]byte(key))
+	if err != nil {
+		panic(err)
+	}
+	return cipher
+}
+
+// getMfaIssuerName is the account issuer shown by authenticator apps,
+// MFA_ISSUER_NAME, defaulting to Sanyukt.
+func getMfaIssuerName() string {
+	if name := os.Getenv("MFA_ISSUER_NAME"); name != "" {
+		return name
+	}
+	return "Sanyukt"
+}
+
+/*
+getWebAuthnRelyingParty scopes passkeys to WEBAUTHN_RP_ID, the domain of the
+web app, defaulting to the host of the issuer. WEBAUTHN_RP_ORIGINS lists the
+comma separated origins the web app is served from, defaulting to the
+issuer, and WEBAUTHN_RP_NAME is shown by the browser, defaulting to the MFA
+issuer name.
+*/
+func getWebAuthnRelyingParty(repo domain.WebAuthnRepository) domain.WebAuthnRelyingParty {
+	issuer, err := url.Parse(getIssuer())
+	if err != nil {
+		panic(err)
+	}
+	rpId := os.Getenv("WEBAUTHN_RP_ID")
+	if rpId == "" {
+		rpId = issuer.Hostname()
+	}
+	origins := []string{issuer.Scheme + "://" + issuer.Host}
+	if v := os.Getenv("WEBAUTHN_RP_ORIGINS"); v != "" {
+		origins = strings.Split(v, ",")
+	}
+	name := os.Getenv("WEBAUTHN_RP_NAME")
+	if name == "" {
+		name = getMfaIssuerName()
+	}
+	rp, err := domain.NewWebAuthnRelyingParty(rpId, name, origins, repo)
+	if err != nil {
+		panic(err)
+	}
+	return rp
+}
+
+// getPasswordHasher returns the hasher for PASSWORD_HASH_ALGORITHM, argon2id
+// (default) or bcrypt. Passwords stored otherwise are rehashed on login;
+// plaintext ones only with PASSWORD_ALLOW_PLAINTEXT=true, while migrating.
+func getPasswordHasher() domain.PasswordHasher {
+	allowPlaintext := os.Getenv("PASSWORD_ALLOW_PLAINTEXT") == "true"
+	if allowPlaintext {
+		logger.Warn("PASSWORD_ALLOW_PLAINTEXT is set, plaintext stored passwords are accepted until users log in again")
+	}
+	hasher, err := domain.NewPasswordHasher(os.Getenv("PASSWORD_HASH_ALGORITHM"), allowPlaintext)
+	if err != nil {
+		panic(err)
+	}
+	return hasher
+}
+
+// getIssuer returns the public base URL of the server, OIDC_ISSUER, used as the
+// iss claim and to build the endpoint URLs of the discovery document.
+func getIssuer() string {
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		return strings.TrimSuffix(issuer, "/")
+	}
+	return fmt.Sprintf("http://%s:%s", os.Getenv("SERVER_ADDRESS"), os.Getenv("SERVER_PORT"))
+}
+
 func sanityCheck() {
 	envProps := []string{
 		"SERVER_ADDRESS",
@@ -63,6 +520,10 @@ func sanityCheck() {
 		"DB_ADDR",
 		"DB_PORT",
 		"DB_NAME",
+		"JWT_KEY_ENCRYPTION_KEY",
+		"OTP_PEPPER",
+		"OTP_CHANNEL",
+		"MFA_SECRET_KEY",
 	}
 	for _, k := range envProps {
 		if os.Getenv(k) == "" {
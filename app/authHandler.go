@@ -2,18 +2,40 @@ package app
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
-	"sanyuktgolang/logger"
-	"sanyuktgolang/model"
-	"sanyuktgolang/service"
+	"strconv"
+	"strings"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+	"github.com/harishkokcha91/sanyuktgolang/service"
+
+	"github.com/gorilla/mux"
 )
 
 type AuthHandler struct {
 	service service.AuthService
 }
 
-func (h AuthHandler) NotImplementedHandler(w http.ResponseWriter, r *http.Request) {
-	writeResponse(w, http.StatusOK, "Handler not implemented...")
+func (h AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var registerRequest model.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&registerRequest); err != nil {
+		logger.Error("Error while decoding register request: " + err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		if registerRequest.Locale == "" {
+			registerRequest.Locale = r.Header.Get("Accept-Language")
+		}
+		registerRequest.ClientIp = clientIp(r)
+		response, appErr := h.service.Register(registerRequest)
+		if appErr != nil {
+			writeResponse(w, appErr.Code, appErr.AsMessage())
+		} else {
+			writeResponse(w, http.StatusCreated, *response)
+		}
+	}
 }
 
 func (h AuthHandler) GenerateOtp(w http.ResponseWriter, r *http.Request) {
@@ -23,7 +45,10 @@ func (h AuthHandler) GenerateOtp(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 
 	} else {
-
+		if loginRequest.Locale == "" {
+			loginRequest.Locale = r.Header.Get("Accept-Language")
+		}
+		loginRequest.ClientIp = clientIp(r)
 		response, appErr := h.service.GenerateOtp(loginRequest)
 		if appErr != nil {
 			writeResponse(w, appErr.Code, appErr.AsMessage())
@@ -40,6 +65,8 @@ func (h AuthHandler) VerifyOtp(w http.ResponseWriter, r *http.Request) {
 		logger.Error("Error while decoding login request: " + err.Error())
 		w.WriteHeader(http.StatusBadRequest)
 	} else {
+		loginRequest.ClientIp = clientIp(r)
+		loginRequest.UserAgent = r.UserAgent()
 		response, appErr := h.service.VerifyOtp(loginRequest)
 		if appErr != nil {
 			writeResponse(w, appErr.Code, appErr.AsMessage())
@@ -56,6 +83,8 @@ func (h AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		logger.Error("Error while decoding login request: " + err.Error())
 		w.WriteHeader(http.StatusBadRequest)
 	} else {
+		loginRequest.ClientIp = clientIp(r)
+		loginRequest.UserAgent = r.UserAgent()
 		token, appErr := h.service.Login(loginRequest)
 		if appErr != nil {
 			writeResponse(w, appErr.Code, appErr.AsMessage())
@@ -69,17 +98,34 @@ func (h AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	Sample URL string
 
 http://localhost:8181/auth/verify?token=somevalimodelkenstring&routeName=GetCustomer&customer_id=2000&account_id=95470
+
+The other query parameters are the parameters of the request being
+authorized, its method is taken from the X-Forwarded-Method header. With
+debug=true, and debugDecisions enabled, the response explains the decision.
 */
 func (h AuthHandler) Verify(w http.ResponseWriter, r *http.Request) {
 	urlParams := make(map[string]string)
 
 	// converting from Query to map type
 	for k := range r.URL.Query() {
-		urlParams[k] = r.URL.Query().Get(k)
+		if k != "token" && k != "routeName" && k != "debug" {
+			urlParams[k] = r.URL.Query().Get(k)
+		}
 	}
 
-	if urlParams["token"] != "" {
-		appErr := h.service.Verify(urlParams)
+	if token := r.URL.Query().Get("token"); token != "" {
+		verifyRequest := model.VerifyRequest{
+			Token:     token,
+			RouteName: r.URL.Query().Get("routeName"),
+			Params:    urlParams,
+			Method:    r.Header.Get("X-Forwarded-Method"),
+			ClientIp:  clientIp(r),
+		}
+		if debugDecisions && r.URL.Query().Get("debug") == "true" {
+			h.explain(w, verifyRequest)
+			return
+		}
+		appErr := h.service.Verify(verifyRequest)
 		if appErr != nil {
 			writeResponse(w, appErr.Code, notAuthorizedResponse(appErr.Message))
 		} else {
@@ -90,6 +136,23 @@ func (h AuthHandler) Verify(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// debugDecisions lets /auth/verify explain its decisions, set from
+// AUTHZ_DEBUG. The traces reveal the permissions and policies, so it is
+// meant for development.
+var debugDecisions bool
+
+func (h AuthHandler) explain(w http.ResponseWriter, verifyRequest model.VerifyRequest) {
+	decision, appErr := h.service.Explain(verifyRequest)
+	switch {
+	case appErr != nil:
+		writeResponse(w, appErr.Code, notAuthorizedResponse(appErr.Message))
+	case decision.IsAuthorized:
+		writeResponse(w, http.StatusOK, *decision)
+	default:
+		writeResponse(w, http.StatusForbidden, *decision)
+	}
+}
+
 func (h AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 	var refreshRequest model.RefreshTokenRequest
 	if err := json.NewDecoder(r.Body).Decode(&refreshRequest); err != nil {
@@ -105,6 +168,45 @@ func (h AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// UnlockAccount clears the failed logins of the user in the path, for admins.
+func (h AuthHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	if appErr := h.service.UnlockAccount(mux.Vars(r)["user_id"]); appErr != nil {
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+/*
+Revoke implements the RFC 7009 revocation endpoint, the request is either
+form encoded as the RFC prescribes or JSON like the other endpoints. The
+response is empty with status 200 for every token, revoked or not.
+*/
+func (h AuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	var revokeRequest model.RevokeTokenRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&revokeRequest); err != nil {
+			logger.Error("Error while decoding revoke token request: " + err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			logger.Error("Error while decoding revoke token request: " + err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		revokeRequest.Token = r.PostForm.Get("token")
+		revokeRequest.TokenTypeHint = r.PostForm.Get("token_type_hint")
+	}
+
+	if appErr := h.service.Revoke(revokeRequest); appErr != nil {
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 func notAuthorizedResponse(msg string) map[string]interface{} {
 	return map[string]interface{}{
 		"isAuthorized": false,
@@ -117,9 +219,57 @@ func authorizedResponse() map[string]bool {
 }
 
 func writeResponse(w http.ResponseWriter, code int, data interface{}) {
+	setRetryAfter(w, data)
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(code)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
 		panic(err)
 	}
 }
+
+// setRetryAfter adds the Retry-After header of rate limited requests.
+func setRetryAfter(w http.ResponseWriter, data interface{}) {
+	if appErr, ok := data.(*errs.AppError); ok && appErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(appErr.RetryAfter))
+	}
+}
+
+// clientIpHeader is the header a trusted reverse proxy puts the client
+// address in, e.g. X-Forwarded-For, set from CLIENT_IP_HEADER. Without it the
+// address of the connection is used. trustedProxies, CLIENT_IP_TRUSTED_PROXIES
+// (default 1), is how many proxies in front of the server append to it.
+var (
+	clientIpHeader string
+	trustedProxies = 1
+)
+
+func clientIp(r *http.Request) string {
+	if clientIpHeader != "" {
+		if ip := forwardedClientIp(r.Header.Get(clientIpHeader)); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+/*
+forwardedClientIp picks the client address out of an X-Forwarded-For style
+header. Clients can send the header with any addresses they like, the
+proxies only append to it, so the entries are taken from the right: the
+address the outermost of the trusted proxies saw is the client.
+*/
+func forwardedClientIp(header string) string {
+	if header == "" {
+		return ""
+	}
+	entries := strings.Split(header, ",")
+	i := len(entries) - trustedProxies
+	if i < 0 {
+		i = 0
+	}
+	return strings.TrimSpace(entries[i])
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/domain"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+	"github.com/harishkokcha91/sanyuktgolang/service"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+ExtAuthzServer is the Envoy external authorization service,
+envoy.service.auth.v3.Authorization. It makes the /auth/verify decision for
+the bearer token of the request, finding the route name and parameters from
+the method and path with the route map. Allowed requests are forwarded with
+the claims of the token in the x-auth-* headers, which are removed when the
+token has no such claim so clients cannot set them.
+*/
+type ExtAuthzServer struct {
+	authv3.UnimplementedAuthorizationServer
+	service service.AuthService
+	routes  *domain.RouteMap
+}
+
+func (s ExtAuthzServer) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	httpRequest := req.GetAttributes().GetRequest().GetHttp()
+	headers := httpRequest.GetHeaders()
+
+	routeName, params, ok := matchRoute(s.routes, httpRequest.GetMethod(), httpRequest.GetPath())
+	if !ok {
+		return deniedCheckResponse(http.StatusForbidden, "unknown route"), nil
+	}
+
+	token := bearerTokenFromHeader(headers["authorization"])
+	if token == "" {
+		return deniedCheckResponse(http.StatusUnauthorized, "missing token"), nil
+	}
+	claims, appErr := s.service.VerifyClaims(model.VerifyRequest{
+		Token:     token,
+		RouteName: routeName,
+		Params:    params,
+		Method:    httpRequest.GetMethod(),
+		ClientIp:  checkRequestClientIp(req),
+	})
+	if appErr != nil {
+		if appErr.Code >= http.StatusInternalServerError {
+			// lets Envoy apply its failure mode instead of denying
+			return nil, status.Error(codes.Internal, appErr.Message)
+		}
+		return deniedCheckResponse(appErr.Code, appErr.Message), nil
+	}
+
+	okResponse := &authv3.OkHttpResponse{}
+	for name, value := range claimHeaders(claims) {
+		if value == "" {
+			okResponse.HeadersToRemove = append(okResponse.HeadersToRemove, name)
+			continue
+		}
+		okResponse.Headers = append(okResponse.Headers, &corev3.HeaderValueOption{
+			Header:       &corev3.HeaderValue{Key: name, Value: value},
+			AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+		})
+	}
+	return &authv3.CheckResponse{
+		Status:       &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{OkResponse: okResponse},
+	}, nil
+}
+
+// matchRoute finds the route of a request the proxy is about to forward, the
+// parameters are those of the path and then of the query string.
+func matchRoute(routes *domain.RouteMap, method string, uri string) (string, map[string]string, bool) {
+	path, query, _ := strings.Cut(uri, "?")
+	routeName, params, ok := routes.Match(method, path)
+	if !ok {
+		return "", nil, false
+	}
+	if values, err := url.ParseQuery(query); err == nil {
+		for k := range values {
+			if _, ok := params[k]; !ok {
+				params[k] = values.Get(k)
+			}
+		}
+	}
+	return routeName, params, true
+}
+
+// claimHeaders are the headers the claims of a verified token are passed to
+// the upstream service in, lists are comma separated.
+func claimHeaders(claims *authz.AccessTokenClaims) map[string]string {
+	return map[string]string{
+		"x-auth-subject":     claims.Subject,
+		"x-auth-user-id":     claims.UserId,
+		"x-auth-username":    claims.Username,
+		"x-auth-customer-id": claims.CustomerId,
+		"x-auth-accounts":    strings.Join(claims.Accounts, ","),
+		"x-auth-roles":       strings.Join(claims.AllRoles(), ","),
+		"x-auth-client-id":   claims.ClientId,
+		"x-auth-scope":       claims.Scope,
+	}
+}
+
+func deniedCheckResponse(code int, message string) *authv3.CheckResponse {
+	grpcCode := codes.PermissionDenied
+	if code == http.StatusUnauthorized {
+		grpcCode = codes.Unauthenticated
+	}
+	body, _ := json.Marshal(notAuthorizedResponse(message))
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(grpcCode), Message: message},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{DeniedResponse: &authv3.DeniedHttpResponse{
+			Status: &typev3.HttpStatus{Code: typev3.StatusCode(code)},
+			Headers: []*corev3.HeaderValueOption{{
+				Header:       &corev3.HeaderValue{Key: "content-type", Value: "application/json"},
+				AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+			}},
+			Body: string(body),
+		}},
+	}
+}
+
+// checkRequestClientIp honours CLIENT_IP_HEADER like clientIp, otherwise the
+// client is the downstream peer of Envoy.
+func checkRequestClientIp(req *authv3.CheckRequest) string {
+	if clientIpHeader != "" {
+		header := req.GetAttributes().GetRequest().GetHttp().GetHeaders()[strings.ToLower(clientIpHeader)]
+		if ip := forwardedClientIp(header); ip != "" {
+			return ip
+		}
+	}
+	return req.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress()
+}
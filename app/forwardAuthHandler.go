@@ -0,0 +1,83 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/harishkokcha91/sanyuktgolang/domain"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+	"github.com/harishkokcha91/sanyuktgolang/service"
+)
+
+/*
+ForwardAuthHandler answers the subrequests of nginx auth_request and Traefik
+ForwardAuth. The request being authorized is described by the
+X-Original-URI (nginx) or X-Forwarded-Uri (Traefik) header and the
+X-Forwarded-Method header, and its route is found with the route map. The
+token is read from the Authorization header or the cookie forwardAuthCookie.
+
+Allowed requests get a 200 with the claims in the X-User-Id, X-Username,
+X-Role, X-Roles, X-Customer-Id and X-Accounts headers for the proxy to copy
+upstream, e.g. with auth_request_set or authResponseHeaders.
+*/
+type ForwardAuthHandler struct {
+	service service.AuthService
+	routes  *domain.RouteMap
+}
+
+// forwardAuthCookie is the cookie holding the access token of browser
+// sessions, set from FORWARD_AUTH_COOKIE.
+var forwardAuthCookie = "access_token"
+
+func (h ForwardAuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	uri := r.Header.Get("X-Original-URI")
+	if uri == "" {
+		uri = r.Header.Get("X-Forwarded-Uri")
+	}
+	method := r.Header.Get("X-Forwarded-Method")
+	if method == "" {
+		method = r.Header.Get("X-Original-Method")
+	}
+	if uri == "" || method == "" {
+		writeResponse(w, http.StatusBadRequest, notAuthorizedResponse("missing X-Original-URI or X-Forwarded-Method header"))
+		return
+	}
+	routeName, params, ok := matchRoute(h.routes, method, uri)
+	if !ok {
+		writeResponse(w, http.StatusForbidden, notAuthorizedResponse("unknown route"))
+		return
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		if cookie, err := r.Cookie(forwardAuthCookie); err == nil {
+			token = cookie.Value
+		}
+	}
+	if token == "" {
+		writeResponse(w, http.StatusUnauthorized, notAuthorizedResponse("missing token"))
+		return
+	}
+	claims, appErr := h.service.VerifyClaims(model.VerifyRequest{
+		Token:     token,
+		RouteName: routeName,
+		Params:    params,
+		Method:    method,
+		ClientIp:  clientIp(r),
+	})
+	if appErr != nil {
+		if appErr.Code >= http.StatusInternalServerError {
+			writeResponse(w, appErr.Code, appErr.AsMessage())
+		} else {
+			writeResponse(w, appErr.Code, notAuthorizedResponse(appErr.Message))
+		}
+		return
+	}
+	w.Header().Set("X-User-Id", claims.UserId)
+	w.Header().Set("X-Username", claims.Username)
+	w.Header().Set("X-Role", claims.Role)
+	w.Header().Set("X-Roles", strings.Join(claims.AllRoles(), ","))
+	w.Header().Set("X-Customer-Id", claims.CustomerId)
+	w.Header().Set("X-Accounts", strings.Join(claims.Accounts, ","))
+	writeResponse(w, http.StatusOK, authorizedResponse())
+}
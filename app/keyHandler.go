@@ -0,0 +1,25 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/harishkokcha91/sanyuktgolang/service"
+)
+
+type KeyHandler struct {
+	service service.KeyService
+}
+
+func (h KeyHandler) Jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Cache-Control", "public, max-age=300")
+	writeResponse(w, http.StatusOK, h.service.Jwks())
+}
+
+func (h KeyHandler) Rotate(w http.ResponseWriter, r *http.Request) {
+	response, appErr := h.service.Rotate()
+	if appErr != nil {
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		writeResponse(w, http.StatusOK, *response)
+	}
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+	"github.com/harishkokcha91/sanyuktgolang/service"
+)
+
+type MfaHandler struct {
+	service service.MfaService
+}
+
+// EnrollTotp starts the TOTP enrollment of the user the bearer token was
+// issued to.
+func (h MfaHandler) EnrollTotp(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r)
+	if token == "" {
+		writeResponse(w, http.StatusUnauthorized, notAuthorizedResponse("missing token"))
+		return
+	}
+	response, appErr := h.service.EnrollTotp(token)
+	if appErr != nil {
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		writeResponse(w, http.StatusOK, *response)
+	}
+}
+
+func (h MfaHandler) ConfirmTotp(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r)
+	if token == "" {
+		writeResponse(w, http.StatusUnauthorized, notAuthorizedResponse("missing token"))
+		return
+	}
+	var confirmRequest model.TotpConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&confirmRequest); err != nil {
+		logger.Error("Error while decoding totp confirm request: " + err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		response, appErr := h.service.ConfirmTotp(token, confirmRequest)
+		if appErr != nil {
+			writeResponse(w, appErr.Code, appErr.AsMessage())
+		} else {
+			writeResponse(w, http.StatusOK, *response)
+		}
+	}
+}
+
+// Verify completes a login answered with mfa_required.
+func (h MfaHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	var verifyRequest model.MfaVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&verifyRequest); err != nil {
+		logger.Error("Error while decoding mfa verify request: " + err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		verifyRequest.ClientIp = clientIp(r)
+		verifyRequest.UserAgent = r.UserAgent()
+		response, appErr := h.service.Verify(verifyRequest)
+		if appErr != nil {
+			writeResponse(w, appErr.Code, appErr.AsMessage())
+		} else {
+			writeResponse(w, http.StatusOK, *response)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/harishkokcha91/sanyuktgolang/model"
+)
+
+// requirePermission only lets requests through when they carry a bearer token
+// whose role is authorized for routeName.
+func (h AuthHandler) requirePermission(routeName string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			writeResponse(w, http.StatusUnauthorized, notAuthorizedResponse("missing token"))
+			return
+		}
+		verifyRequest := model.VerifyRequest{Token: token, RouteName: routeName, Method: r.Method, ClientIp: clientIp(r)}
+		if appErr := h.service.Verify(verifyRequest); appErr != nil {
+			writeResponse(w, appErr.Code, notAuthorizedResponse(appErr.Message))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	return bearerTokenFromHeader(r.Header.Get("Authorization"))
+}
+
+// bearerTokenFromHeader returns the token of a Bearer Authorization header.
+func bearerTokenFromHeader(authorization string) string {
+	parts := strings.SplitN(authorization, " ", 2)
+	if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+		return strings.TrimSpace(parts[1])
+	}
+	return ""
+}
@@ -0,0 +1,226 @@
+package app
+
+import (
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+
+	"github.com/harishkokcha91/sanyuktgolang/domain"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+	"github.com/harishkokcha91/sanyuktgolang/service"
+)
+
+// csrfCookie holds the token the login form has to be posted with.
+const csrfCookie = "oauth_csrf"
+
+type OAuthHandler struct {
+	service service.OAuthService
+}
+
+/*
+Introspect implements the RFC 7662 endpoint. Clients authenticate with HTTP
+Basic or with client_id and client_secret in the form body.
+*/
+func (h OAuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logger.Error("Error while decoding introspection request: " + err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	clientId, clientSecret := clientCredentials(r)
+	request := model.IntrospectionRequest{
+		Token:         r.PostForm.Get("token"),
+		TokenTypeHint: r.PostForm.Get("token_type_hint"),
+		ClientId:      clientId,
+		ClientSecret:  clientSecret,
+	}
+
+	response, appErr := h.service.Introspect(request)
+	if appErr != nil {
+		if appErr.Code == http.StatusUnauthorized {
+			w.Header().Add("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		w.Header().Add("Cache-Control", "no-store")
+		writeResponse(w, http.StatusOK, *response)
+	}
+}
+
+func clientCredentials(r *http.Request) (string, string) {
+	if clientId, clientSecret, ok := r.BasicAuth(); ok {
+		return clientId, clientSecret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
+
+func (h OAuthHandler) Discovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Cache-Control", "public, max-age=300")
+	writeResponse(w, http.StatusOK, h.service.Discovery())
+}
+
+func (h OAuthHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r)
+	if token == "" {
+		w.Header().Add("WWW-Authenticate", "Bearer")
+		writeResponse(w, http.StatusUnauthorized, notAuthorizedResponse("missing token"))
+		return
+	}
+	response, appErr := h.service.UserInfo(token)
+	if appErr != nil {
+		if appErr.Code == http.StatusUnauthorized {
+			w.Header().Add("WWW-Authenticate", `Bearer error="invalid_token"`)
+		}
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		writeResponse(w, http.StatusOK, *response)
+	}
+}
+
+/*
+Authorize implements the OAuth authorization endpoint. GET shows the login
+form for a valid authorization request, POST authenticates the user and
+redirects back to the client with the authorization code. The form carries a
+CSRF token bound to a cookie, so a form posted from another site is refused
+before the credentials are even looked at.
+*/
+func (h OAuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logger.Error("Error while decoding authorization request: " + err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	request := model.AuthorizeRequest{
+		ResponseType:        r.Form.Get("response_type"),
+		ClientId:            r.Form.Get("client_id"),
+		RedirectUri:         r.Form.Get("redirect_uri"),
+		Scope:               r.Form.Get("scope"),
+		State:               r.Form.Get("state"),
+		Nonce:               r.Form.Get("nonce"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+	}
+
+	var response *model.AuthorizeResponse
+	var appErr *errs.AppError
+	if r.Method == http.MethodPost && !isValidCsrfToken(r) {
+		writeHtml(w, http.StatusForbidden, errorPageTemplate, errs.NewAuthorizationError("the sign in form expired, please start over"))
+		return
+	}
+	csrfToken := issueCsrfToken(w, r)
+	if r.Method == http.MethodPost {
+		request.Username = r.PostForm.Get("username")
+		request.Password = r.PostForm.Get("password")
+		request.MfaToken = r.PostForm.Get("mfa_token")
+		request.MfaCode = r.PostForm.Get("mfa_code")
+		request.ClientIp = clientIp(r)
+		request.UserAgent = r.UserAgent()
+		response, appErr = h.service.Authorize(request)
+	} else {
+		response, appErr = h.service.ValidateAuthorizeRequest(request)
+	}
+
+	switch {
+	case appErr != nil && appErr.Code == http.StatusUnauthorized:
+		request.Password = ""
+		request.MfaCode = ""
+		if appErr.ErrorCode == "invalid_mfa_token" {
+			// start over with the password
+			request.MfaToken = ""
+		}
+		writeHtml(w, http.StatusUnauthorized, loginFormTemplate, map[string]interface{}{"Request": request, "CsrfToken": csrfToken, "Error": appErr.Message})
+	case appErr != nil:
+		writeHtml(w, appErr.Code, errorPageTemplate, appErr)
+	case response != nil && response.MfaToken != "":
+		request.Password = ""
+		request.MfaToken = response.MfaToken
+		writeHtml(w, http.StatusOK, loginFormTemplate, map[string]interface{}{"Request": request, "CsrfToken": csrfToken})
+	case response != nil:
+		http.Redirect(w, r, response.RedirectUri, http.StatusSeeOther)
+	default:
+		writeHtml(w, http.StatusOK, loginFormTemplate, map[string]interface{}{"Request": request, "CsrfToken": csrfToken})
+	}
+}
+
+// issueCsrfToken returns the CSRF token of the login form, keeping the one
+// the cookie already holds so forms open in several tabs stay valid.
+func issueCsrfToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && len(cookie.Value) == 64 {
+		return cookie.Value
+	}
+	token := domain.NewRandomId() + domain.NewRandomId()
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/oauth/authorize",
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+func isValidCsrfToken(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostForm.Get("csrf_token"))) == 1
+}
+
+// Token implements the OAuth token endpoint, errors are reported as described
+// in RFC 6749 section 5.2.
+func (h OAuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logger.Error("Error while decoding token request: " + err.Error())
+		writeOAuthError(w, errs.NewCodedError(http.StatusBadRequest, "invalid_request", "malformed token request"))
+		return
+	}
+	clientId, clientSecret := clientCredentials(r)
+	request := model.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectUri:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		Scope:        r.PostForm.Get("scope"),
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+	}
+
+	w.Header().Add("Cache-Control", "no-store")
+	response, appErr := h.service.Token(request)
+	if appErr != nil {
+		writeOAuthError(w, appErr)
+	} else {
+		writeResponse(w, http.StatusOK, *response)
+	}
+}
+
+func writeOAuthError(w http.ResponseWriter, appErr *errs.AppError) {
+	errorCode := appErr.ErrorCode
+	if errorCode == "" {
+		errorCode = "server_error"
+	}
+	if appErr.Code == http.StatusUnauthorized {
+		w.Header().Add("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	setRetryAfter(w, appErr)
+	writeResponse(w, appErr.Code, map[string]string{
+		"error":             errorCode,
+		"error_description": appErr.Message,
+	})
+}
+
+func writeHtml(w http.ResponseWriter, code int, tmpl *template.Template, data interface{}) {
+	setRetryAfter(w, data)
+	w.Header().Add("Content-Type", "text/html; charset=utf-8")
+	w.Header().Add("X-Frame-Options", "DENY")
+	w.Header().Add("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := tmpl.Execute(w, data); err != nil {
+		logger.Error("Error while rendering page: " + err.Error())
+	}
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+	"github.com/harishkokcha91/sanyuktgolang/service"
+)
+
+type PolicyHandler struct {
+	service service.PolicyService
+}
+
+// Evaluate is a dry run of /auth/verify for the claims in the request body,
+// the decision is returned with status 200 either way.
+func (h PolicyHandler) Evaluate(w http.ResponseWriter, r *http.Request) {
+	var evaluateRequest model.PolicyEvaluateRequest
+	if err := json.NewDecoder(r.Body).Decode(&evaluateRequest); err != nil {
+		logger.Error("Error while decoding policy evaluate request: " + err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		decision, appErr := h.service.Evaluate(evaluateRequest)
+		if appErr != nil {
+			writeResponse(w, appErr.Code, appErr.AsMessage())
+		} else {
+			writeResponse(w, http.StatusOK, *decision)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+	"github.com/harishkokcha91/sanyuktgolang/service"
+
+	"github.com/gorilla/mux"
+)
+
+type RoleHandler struct {
+	service service.RoleService
+}
+
+func (h RoleHandler) FindAll(w http.ResponseWriter, r *http.Request) {
+	roles, appErr := h.service.FindAll()
+	if appErr != nil {
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		writeResponse(w, http.StatusOK, roles)
+	}
+}
+
+func (h RoleHandler) Find(w http.ResponseWriter, r *http.Request) {
+	role, appErr := h.service.Find(mux.Vars(r)["role"])
+	if appErr != nil {
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		writeResponse(w, http.StatusOK, *role)
+	}
+}
+
+// Save creates or replaces the role in the path.
+func (h RoleHandler) Save(w http.ResponseWriter, r *http.Request) {
+	var roleRequest model.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&roleRequest); err != nil {
+		logger.Error("Error while decoding role request: " + err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		role, appErr := h.service.Save(mux.Vars(r)["role"], roleRequest)
+		if appErr != nil {
+			writeResponse(w, appErr.Code, appErr.AsMessage())
+		} else {
+			writeResponse(w, http.StatusOK, *role)
+		}
+	}
+}
+
+func (h RoleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if appErr := h.service.Delete(mux.Vars(r)["role"]); appErr != nil {
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Reload picks up changes made directly in the tables without waiting for
+// the scheduled reload.
+func (h RoleHandler) Reload(w http.ResponseWriter, r *http.Request) {
+	if appErr := h.service.Reload(); appErr != nil {
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
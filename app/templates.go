@@ -0,0 +1,43 @@
+package app
+
+import "html/template"
+
+// loginFormTemplate is the login page of the authorization endpoint, it posts
+// the credentials back along with the authorization request and the CSRF
+// token. With an MFA challenge token it asks for the code of the second
+// factor instead.
+var loginFormTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<h1>Sign in</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="csrf_token" value="{{.CsrfToken}}">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientId}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectUri}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+{{if .Request.MfaToken}}<input type="hidden" name="mfa_token" value="{{.Request.MfaToken}}">
+<label>Authenticator code <input type="text" name="mfa_code" inputmode="numeric" autocomplete="one-time-code" required autofocus></label>
+{{else}}<label>Username <input type="text" name="username" value="{{.Request.Username}}" autocomplete="username" required></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+{{end}}<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Authorization error</title></head>
+<body>
+<h1>Authorization error</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`))
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+	"github.com/harishkokcha91/sanyuktgolang/service"
+)
+
+// maxWebAuthnResponseSize bounds the credential responses read from clients,
+// attestation objects are a few kilobytes at most.
+const maxWebAuthnResponseSize = 64 * 1024
+
+type WebAuthnHandler struct {
+	service service.WebAuthnService
+}
+
+// BeginRegistration returns the options for navigator.credentials.create().
+func (h WebAuthnHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r)
+	if token == "" {
+		writeResponse(w, http.StatusUnauthorized, notAuthorizedResponse("missing token"))
+		return
+	}
+	options, appErr := h.service.BeginRegistration(token)
+	if appErr != nil {
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		writeResponse(w, http.StatusOK, *options)
+	}
+}
+
+// FinishRegistration takes the PublicKeyCredential created by the browser as
+// the request body.
+func (h WebAuthnHandler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r)
+	if token == "" {
+		writeResponse(w, http.StatusUnauthorized, notAuthorizedResponse("missing token"))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebAuthnResponseSize))
+	if err != nil {
+		logger.Error("Error while reading webauthn registration: " + err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	response, appErr := h.service.FinishRegistration(token, body)
+	if appErr != nil {
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		writeResponse(w, http.StatusCreated, *response)
+	}
+}
+
+// BeginLogin returns the options for navigator.credentials.get().
+func (h WebAuthnHandler) BeginLogin(w http.ResponseWriter, r *http.Request) {
+	options, appErr := h.service.BeginLogin()
+	if appErr != nil {
+		writeResponse(w, appErr.Code, appErr.AsMessage())
+	} else {
+		writeResponse(w, http.StatusOK, *options)
+	}
+}
+
+func (h WebAuthnHandler) FinishLogin(w http.ResponseWriter, r *http.Request) {
+	var loginRequest model.WebAuthnLoginRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxWebAuthnResponseSize)).Decode(&loginRequest); err != nil {
+		logger.Error("Error while decoding webauthn login request: " + err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		loginRequest.ClientIp = clientIp(r)
+		loginRequest.UserAgent = r.UserAgent()
+		response, appErr := h.service.FinishLogin(loginRequest)
+		if appErr != nil {
+			writeResponse(w, appErr.Code, appErr.AsMessage())
+		} else {
+			writeResponse(w, http.StatusOK, *response)
+		}
+	}
+}
+
+// BeginSecondFactor returns the options for navigator.credentials.get() to
+// answer an MFA challenge with a passkey.
+func (h WebAuthnHandler) BeginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var verifyRequest model.MfaVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&verifyRequest); err != nil {
+		logger.Error("Error while decoding mfa request: " + err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		options, appErr := h.service.BeginSecondFactor(verifyRequest)
+		if appErr != nil {
+			writeResponse(w, appErr.Code, appErr.AsMessage())
+		} else {
+			writeResponse(w, http.StatusOK, *options)
+		}
+	}
+}
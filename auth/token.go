@@ -8,36 +8,30 @@ import (
 	"os"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 
-	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/harishkokcha91/sanyuktgolang/middleware"
 )
 
-func CreateToken(user_id uint32) (string, error) {
-	claims := jwt.MapClaims{}
-	claims["authorized"] = true
-	claims["user_id"] = user_id
-	claims["exp"] = time.Now().Add(time.Hour * 1).Unix() //Token expires after 1 hour
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("API_SECRET")))
+var (
+	validatorOnce sync.Once
+	validator     middleware.Validator
+)
 
+// sharedKeyValidator reads API_SECRET once, on first use.
+func sharedKeyValidator() middleware.Validator {
+	validatorOnce.Do(func() {
+		validator = middleware.NewSharedKeyValidator([]byte(os.Getenv("API_SECRET")), "")
+	})
+	return validator
 }
 
+// TokenValid checks the access token of the request against API_SECRET.
+//
+// Deprecated: use middleware.Authenticate, which also supports JWKS.
 func TokenValid(r *http.Request) error {
-	tokenString := ExtractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("API_SECRET")), nil
-	})
-	if err != nil {
-		return err
-	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		Pretty(claims)
-	}
-	return nil
+	_, err := sharedKeyValidator().ValidateAccessToken(ExtractToken(r))
+	return err
 }
 
 func ExtractToken(r *http.Request) string {
@@ -53,27 +47,19 @@ func ExtractToken(r *http.Request) string {
 	return ""
 }
 
+// ExtractTokenID returns the user id of the access token of the request.
+//
+// Deprecated: use middleware.ClaimsFromContext after middleware.Authenticate.
 func ExtractTokenID(r *http.Request) (uint32, error) {
-
-	tokenString := ExtractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("API_SECRET")), nil
-	})
+	claims, err := sharedKeyValidator().ValidateAccessToken(ExtractToken(r))
 	if err != nil {
 		return 0, err
 	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["user_id"]), 10, 32)
-		if err != nil {
-			return 0, err
-		}
-		return uint32(uid), nil
+	uid, err := strconv.ParseUint(claims.UserId, 10, 32)
+	if err != nil {
+		return 0, err
 	}
-	return 0, nil
+	return uint32(uid), nil
 }
 
 // Pretty display the claims licely in the terminal
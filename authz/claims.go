@@ -0,0 +1,83 @@
+/*
+Package authz holds what an authorization decision is made on and the rules
+it is made with: the access token claims, the signing keys they are verified
+with, the roles and the policies. It has no storage dependencies, so resource
+servers can import it with the middleware package.
+*/
+package authz
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+	// see MfaChallengeClaims in the domain package
+	TokenTypeMfaChallenge = "mfa_challenge"
+)
+
+// AccessTokenClaims carry the primary role of the principal in role and, when
+// it holds more than one, all of them in roles.
+type AccessTokenClaims struct {
+	TokenType  string   `json:"token_type,omitempty"`
+	UserId     string   `json:"user_id,omitempty"`
+	CustomerId string   `json:"customer_id"`
+	Accounts   []string `json:"accounts"`
+	Username   string   `json:"username"`
+	ClientId   string   `json:"client_id,omitempty"`
+	Role       string   `json:"role"`
+	Roles      []string `json:"roles,omitempty"`
+	Scope      string   `json:"scope,omitempty"`
+	jwt.StandardClaims
+}
+
+// AllRoles returns the roles permissions are checked against, tokens issued
+// before multiple roles were supported only carry the role claim.
+func (c AccessTokenClaims) AllRoles() []string {
+	if len(c.Roles) > 0 {
+		return c.Roles
+	}
+	return []string{c.Role}
+}
+
+// UnmarshalJSON also accepts a user_id claim issued as a number, e.g. by the
+// API signing with the shared API_SECRET, and keeps it as its decimal string.
+func (c *AccessTokenClaims) UnmarshalJSON(b []byte) error {
+	type claims AccessTokenClaims
+	aux := struct {
+		*claims
+		UserId json.RawMessage `json:"user_id,omitempty"`
+	}{claims: (*claims)(c)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	c.UserId = ""
+	if len(aux.UserId) == 0 || string(aux.UserId) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(aux.UserId, &c.UserId); err == nil {
+		return nil
+	}
+	var id json.Number
+	if err := json.Unmarshal(aux.UserId, &id); err != nil {
+		return err
+	}
+	if _, err := strconv.ParseUint(id.String(), 10, 64); err != nil {
+		return err
+	}
+	c.UserId = id.String()
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
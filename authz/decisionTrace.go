@@ -0,0 +1,60 @@
+package authz
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	TracePass    = "pass"
+	TraceFail    = "fail"
+	TraceMatch   = "match"
+	TraceNoMatch = "no_match"
+	TraceSkip    = "skip"
+)
+
+// TraceStep is one check made while deciding on a request, like a matched
+// permission or the outcome of a policy condition.
+type TraceStep struct {
+	Step   string `json:"step"`
+	Name   string `json:"name,omitempty"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// DecisionTrace records the steps of an authorization decision. A nil trace
+// records nothing, so the checks can run the same with and without it.
+type DecisionTrace struct {
+	Steps []TraceStep
+}
+
+func (t *DecisionTrace) add(step string, name string, result string, detail string) {
+	if t != nil {
+		t.Steps = append(t.Steps, TraceStep{Step: step, Name: name, Result: result, Detail: detail})
+	}
+}
+
+// Add records a step made outside the role and policy checks, like the token
+// validation.
+func (t *DecisionTrace) Add(step string, name string, result string, detail string) {
+	t.add(step, name, result, detail)
+}
+
+func traceResult(ok bool, pass string, fail string) string {
+	if ok {
+		return pass
+	}
+	return fail
+}
+
+// describeValues renders attribute values for a trace, absent ones as such.
+func describeValues(values []string) string {
+	switch len(values) {
+	case 0:
+		return "absent"
+	case 1:
+		return fmt.Sprintf("%q", values[0])
+	default:
+		return fmt.Sprintf("[%s]", strings.Join(values, ", "))
+	}
+}
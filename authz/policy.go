@@ -0,0 +1,456 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+AccessRequest is what an authorization decision is made on: the claims of
+the verified token and the request the resource server is about to serve.
+Roles are the roles of the claims with the roles they inherit, see
+RolePermissions.EffectiveRoles; without them only the roles of the claims
+are known.
+*/
+type AccessRequest struct {
+	Claims    *AccessTokenClaims
+	Roles     []string
+	RouteName string
+	Params    map[string]string
+	Method    string
+	ClientIp  string
+	Time      time.Time
+}
+
+/*
+attribute returns the values of an attribute of the request, nil when it is
+absent. The attributes are
+
+	token.<claim>    user_id, customer_id, accounts, username, client_id,
+	                 role, roles, scope and sub
+	params.<name>    the request parameters, e.g. params.customer_id
+	request.route, request.method, request.ip
+	time.of_day      "15:04" in the time zone of the policy set
+	time.weekday     "Monday" to "Sunday"
+
+Claims holding lists, accounts, roles and scope, have a value per entry.
+*/
+func (r AccessRequest) attribute(name string, location *time.Location) []string {
+	namespace, key, _ := strings.Cut(name, ".")
+	switch namespace {
+	case "token":
+		if r.Claims == nil {
+			return nil
+		}
+		switch key {
+		case "user_id":
+			return nonEmpty(r.Claims.UserId)
+		case "customer_id":
+			return nonEmpty(r.Claims.CustomerId)
+		case "accounts":
+			return r.Claims.Accounts
+		case "username":
+			return nonEmpty(r.Claims.Username)
+		case "client_id":
+			return nonEmpty(r.Claims.ClientId)
+		case "role":
+			return nonEmpty(r.Claims.Role)
+		case "roles":
+			return r.Claims.AllRoles()
+		case "scope":
+			return strings.Fields(r.Claims.Scope)
+		case "sub":
+			return nonEmpty(r.Claims.Subject)
+		}
+	case "params":
+		if v, ok := r.Params[key]; ok {
+			return []string{v}
+		}
+	case "request":
+		switch key {
+		case "route":
+			return nonEmpty(r.RouteName)
+		case "method":
+			return nonEmpty(strings.ToUpper(r.Method))
+		case "ip":
+			return nonEmpty(r.ClientIp)
+		}
+	case "time":
+		switch key {
+		case "of_day":
+			return []string{r.Time.In(location).Format("15:04")}
+		case "weekday":
+			return []string{r.Time.In(location).Weekday().String()}
+		}
+	}
+	return nil
+}
+
+func (r AccessRequest) roles() []string {
+	if r.Roles != nil {
+		return r.Roles
+	}
+	if r.Claims == nil {
+		return nil
+	}
+	return r.Claims.AllRoles()
+}
+
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+var policyAttributes = map[string][]string{
+	"token":   {"user_id", "customer_id", "accounts", "username", "client_id", "role", "roles", "scope", "sub"},
+	"request": {"route", "method", "ip"},
+	"time":    {"of_day", "weekday"},
+}
+
+func validAttribute(name string) bool {
+	namespace, key, ok := strings.Cut(name, ".")
+	if !ok || key == "" {
+		return false
+	}
+	if namespace == "params" {
+		return true
+	}
+	return contains(policyAttributes[namespace], key)
+}
+
+/*
+Condition is an expression over the attributes of an AccessRequest. It either
+combines other conditions with all, any or not, or compares the attribute
+attr with op against value, values, or the attribute ref:
+
+	present, absent   the attribute has a value, or none
+	eq, ne            the first value equals value or the first value of ref,
+	                  an absent attribute being ""
+	in                every value is one of values or of the values of ref
+	prefix            the first value starts with value
+	cidr              the first value is an IP address in one of the values
+	between           values[0] <= first value <= values[1], wrapping around
+	                  when values[0] > values[1], e.g. for times of day
+*/
+type Condition struct {
+	All    []Condition `json:"all,omitempty"`
+	Any    []Condition `json:"any,omitempty"`
+	Not    *Condition  `json:"not,omitempty"`
+	Attr   string      `json:"attr,omitempty"`
+	Op     string      `json:"op,omitempty"`
+	Value  string      `json:"value,omitempty"`
+	Values []string    `json:"values,omitempty"`
+	Ref    string      `json:"ref,omitempty"`
+
+	networks []*net.IPNet
+}
+
+func (c *Condition) compile() error {
+	switch {
+	case c.All != nil || c.Any != nil:
+		for i := range c.All {
+			if err := c.All[i].compile(); err != nil {
+				return err
+			}
+		}
+		for i := range c.Any {
+			if err := c.Any[i].compile(); err != nil {
+				return err
+			}
+		}
+		return nil
+	case c.Not != nil:
+		return c.Not.compile()
+	}
+
+	if !validAttribute(c.Attr) {
+		return fmt.Errorf("unknown attribute %q", c.Attr)
+	}
+	if c.Ref != "" && !validAttribute(c.Ref) {
+		return fmt.Errorf("unknown attribute %q", c.Ref)
+	}
+	switch c.Op {
+	case "present", "absent", "eq", "ne", "in", "prefix":
+	case "cidr":
+		for _, v := range c.Values {
+			_, network, err := net.ParseCIDR(v)
+			if err != nil {
+				return fmt.Errorf("condition on %s: %w", c.Attr, err)
+			}
+			c.networks = append(c.networks, network)
+		}
+	case "between":
+		if len(c.Values) != 2 {
+			return fmt.Errorf("condition on %s: between needs two values", c.Attr)
+		}
+	default:
+		return fmt.Errorf("condition on %s: unknown operator %q", c.Attr, c.Op)
+	}
+	return nil
+}
+
+// evaluate records the outcome of every comparison made in the trace, under
+// the name of the policy.
+func (c Condition) evaluate(r AccessRequest, location *time.Location, policy string, trace *DecisionTrace) bool {
+	switch {
+	case c.All != nil || c.Any != nil:
+		for _, sub := range c.All {
+			if !sub.evaluate(r, location, policy, trace) {
+				return false
+			}
+		}
+		if c.Any == nil {
+			return true
+		}
+		for _, sub := range c.Any {
+			if sub.evaluate(r, location, policy, trace) {
+				return true
+			}
+		}
+		return false
+	case c.Not != nil:
+		return !c.Not.evaluate(r, location, policy, trace)
+	}
+
+	holds := c.compare(r, location)
+	trace.add("condition", policy, traceResult(holds, TracePass, TraceFail), c.describe(r, location))
+	return holds
+}
+
+func (c Condition) describe(r AccessRequest, location *time.Location) string {
+	detail := fmt.Sprintf("%s %s %s", c.Attr, describeValues(r.attribute(c.Attr, location)), c.Op)
+	switch {
+	case c.Ref != "":
+		return detail + fmt.Sprintf(" %s %s", c.Ref, describeValues(r.attribute(c.Ref, location)))
+	case c.Values != nil:
+		return detail + " " + describeValues(c.Values)
+	case c.Op != "present" && c.Op != "absent":
+		return detail + fmt.Sprintf(" %q", c.Value)
+	}
+	return detail
+}
+
+func (c Condition) compare(r AccessRequest, location *time.Location) bool {
+
+	values := r.attribute(c.Attr, location)
+	first := ""
+	if len(values) > 0 {
+		first = values[0]
+	}
+	operand := c.Value
+	operands := c.Values
+	if c.Ref != "" {
+		operands = r.attribute(c.Ref, location)
+		operand = ""
+		if len(operands) > 0 {
+			operand = operands[0]
+		}
+	}
+
+	switch c.Op {
+	case "present":
+		return len(values) > 0
+	case "absent":
+		return len(values) == 0
+	case "eq":
+		return first == operand
+	case "ne":
+		return first != operand
+	case "in":
+		for _, v := range values {
+			if !contains(operands, v) {
+				return false
+			}
+		}
+		return len(values) > 0
+	case "prefix":
+		return len(values) > 0 && strings.HasPrefix(first, operand)
+	case "cidr":
+		ip := net.ParseIP(first)
+		for _, network := range c.networks {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	case "between":
+		lo, hi := c.Values[0], c.Values[1]
+		if lo <= hi {
+			return lo <= first && first <= hi
+		}
+		return first >= lo || first <= hi
+	}
+	return false
+}
+
+const (
+	// the conditions of a require policy must hold for the request to pass
+	PolicyEffectRequire = "require"
+	// a deny policy rejects the requests its conditions hold for
+	PolicyEffectDeny = "deny"
+)
+
+/*
+Policy constrains the requests it targets, those for one of its routes
+(route patterns as for roles), made by a principal holding one of its roles
+and none of its except roles, and with one of its methods. Roles are held
+directly or inherited. An empty target list matches everything.
+*/
+type Policy struct {
+	Name        string    `json:"name"`
+	Routes      []string  `json:"routes,omitempty"`
+	Roles       []string  `json:"roles,omitempty"`
+	ExceptRoles []string  `json:"except_roles,omitempty"`
+	Methods     []string  `json:"methods,omitempty"`
+	Effect      string    `json:"effect,omitempty"`
+	Condition   Condition `json:"condition"`
+	// Message is returned to the caller when the policy rejects a request.
+	Message string `json:"message,omitempty"`
+}
+
+func (p Policy) targets(r AccessRequest) bool {
+	if len(p.Routes) > 0 && !anyMatch(p.Routes, func(pattern string) bool { return MatchRoute(pattern, r.RouteName) }) {
+		return false
+	}
+	roles := r.roles()
+	if len(p.Roles) > 0 && !anyMatch(p.Roles, func(role string) bool { return contains(roles, role) }) {
+		return false
+	}
+	if anyMatch(p.ExceptRoles, func(role string) bool { return contains(roles, role) }) {
+		return false
+	}
+	if len(p.Methods) > 0 && !anyMatch(p.Methods, func(method string) bool { return strings.EqualFold(method, r.Method) }) {
+		return false
+	}
+	return true
+}
+
+func anyMatch(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyDecision is the outcome of evaluating a policy set, Policy names the
+// policy that rejected the request.
+type PolicyDecision struct {
+	Allowed bool
+	Policy  string
+	Message string
+}
+
+/*
+PolicySet holds the attribute based policies /auth/verify applies after the
+role permissions. Every targeted policy must pass, the first one that does
+not rejects the request.
+*/
+type PolicySet struct {
+	Timezone string   `json:"timezone,omitempty"`
+	Policies []Policy `json:"policies"`
+
+	location *time.Location
+}
+
+func (s *PolicySet) compile() error {
+	s.location = time.Local
+	if s.Timezone != "" {
+		location, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return err
+		}
+		s.location = location
+	}
+	for i := range s.Policies {
+		p := &s.Policies[i]
+		if p.Name == "" {
+			return fmt.Errorf("policy %d has no name", i+1)
+		}
+		switch p.Effect {
+		case "":
+			p.Effect = PolicyEffectRequire
+		case PolicyEffectRequire, PolicyEffectDeny:
+		default:
+			return fmt.Errorf("policy %s: unknown effect %q", p.Name, p.Effect)
+		}
+		if err := p.Condition.compile(); err != nil {
+			return fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+		if p.Message == "" {
+			p.Message = "request denied by policy " + p.Name
+		}
+	}
+	return nil
+}
+
+func (s *PolicySet) Evaluate(r AccessRequest) PolicyDecision {
+	return s.Explain(r, nil)
+}
+
+// Explain is Evaluate recording the targeted policies and their conditions
+// in the trace.
+func (s *PolicySet) Explain(r AccessRequest, trace *DecisionTrace) PolicyDecision {
+	for _, p := range s.Policies {
+		if !p.targets(r) {
+			trace.add("policy", p.Name, TraceSkip, "request not targeted")
+			continue
+		}
+		holds := p.Condition.evaluate(r, s.location, p.Name, trace)
+		if (p.Effect == PolicyEffectRequire) != holds {
+			trace.add("policy", p.Name, TraceFail, p.Effect+" policy rejects the request")
+			return PolicyDecision{Allowed: false, Policy: p.Name, Message: p.Message}
+		}
+		trace.add("policy", p.Name, TracePass, p.Effect+" policy lets the request pass")
+	}
+	return PolicyDecision{Allowed: true}
+}
+
+/*
+DefaultPolicies only let customers access their own resources: the
+customer_id parameter must be the customer of the token, and an account_id
+one of its accounts. Admins inherit the customer role but serve every
+customer.
+*/
+func DefaultPolicies() *PolicySet {
+	s := &PolicySet{Policies: []Policy{{
+		Name:        "customer-owns-resource",
+		Roles:       []string{DefaultUserRole},
+		ExceptRoles: []string{AdminRole},
+		Condition: Condition{All: []Condition{
+			{Attr: "params.customer_id", Op: "eq", Ref: "token.customer_id"},
+			{Any: []Condition{
+				{Attr: "params.account_id", Op: "absent"},
+				{Attr: "params.account_id", Op: "in", Ref: "token.accounts"},
+			}},
+		}},
+		Message: "request not verified with the token claims",
+	}}}
+	if err := s.compile(); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// LoadPolicies reads a policy set from a JSON file.
+func LoadPolicies(path string) (*PolicySet, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s PolicySet
+	if err = json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err = s.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
@@ -0,0 +1,158 @@
+package authz
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConditionOperators(t *testing.T) {
+	request := AccessRequest{
+		Claims: &AccessTokenClaims{
+			CustomerId: "2000",
+			Accounts:   []string{"95470", "95471"},
+			Role:       "user",
+			Scope:      "openid profile",
+		},
+		Params:   map[string]string{"customer_id": "2000", "account_id": "95470", "other_id": "2001"},
+		Method:   "get",
+		ClientIp: "10.1.2.3",
+		Time:     time.Date(2024, time.March, 4, 22, 30, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		name      string
+		condition Condition
+		want      bool
+	}{
+		{"present", Condition{Attr: "params.customer_id", Op: "present"}, true},
+		{"present missing", Condition{Attr: "params.unknown", Op: "present"}, false},
+		{"absent", Condition{Attr: "token.user_id", Op: "absent"}, true},
+		{"absent present", Condition{Attr: "token.customer_id", Op: "absent"}, false},
+		{"eq value", Condition{Attr: "request.method", Op: "eq", Value: "GET"}, true},
+		{"eq ref", Condition{Attr: "params.customer_id", Op: "eq", Ref: "token.customer_id"}, true},
+		{"eq ref differs", Condition{Attr: "params.other_id", Op: "eq", Ref: "token.customer_id"}, false},
+		{"eq absent is empty", Condition{Attr: "params.unknown", Op: "eq", Value: ""}, true},
+		{"ne", Condition{Attr: "params.other_id", Op: "ne", Ref: "token.customer_id"}, true},
+		{"in ref", Condition{Attr: "params.account_id", Op: "in", Ref: "token.accounts"}, true},
+		{"in ref missing", Condition{Attr: "params.other_id", Op: "in", Ref: "token.accounts"}, false},
+		{"in every value", Condition{Attr: "token.scope", Op: "in", Values: []string{"openid", "profile", "email"}}, true},
+		{"in not every value", Condition{Attr: "token.scope", Op: "in", Values: []string{"openid"}}, false},
+		{"in absent", Condition{Attr: "params.unknown", Op: "in", Values: []string{""}}, false},
+		{"prefix", Condition{Attr: "params.account_id", Op: "prefix", Value: "954"}, true},
+		{"prefix differs", Condition{Attr: "params.account_id", Op: "prefix", Value: "96"}, false},
+		{"cidr", Condition{Attr: "request.ip", Op: "cidr", Values: []string{"192.168.0.0/16", "10.0.0.0/8"}}, true},
+		{"cidr outside", Condition{Attr: "request.ip", Op: "cidr", Values: []string{"192.168.0.0/16"}}, false},
+		{"cidr not an ip", Condition{Attr: "params.customer_id", Op: "cidr", Values: []string{"0.0.0.0/0"}}, false},
+		{"between", Condition{Attr: "time.of_day", Op: "between", Values: []string{"08:00", "23:00"}}, true},
+		{"between outside", Condition{Attr: "time.of_day", Op: "between", Values: []string{"08:00", "18:00"}}, false},
+		{"between wrapping", Condition{Attr: "time.of_day", Op: "between", Values: []string{"22:00", "06:00"}}, true},
+		{"weekday", Condition{Attr: "time.weekday", Op: "eq", Value: "Monday"}, true},
+		{"all", Condition{All: []Condition{
+			{Attr: "params.customer_id", Op: "present"},
+			{Attr: "params.other_id", Op: "present"},
+		}}, true},
+		{"all one fails", Condition{All: []Condition{
+			{Attr: "params.customer_id", Op: "present"},
+			{Attr: "params.unknown", Op: "present"},
+		}}, false},
+		{"any", Condition{Any: []Condition{
+			{Attr: "params.unknown", Op: "present"},
+			{Attr: "params.customer_id", Op: "present"},
+		}}, true},
+		{"any none holds", Condition{Any: []Condition{
+			{Attr: "params.unknown", Op: "present"},
+		}}, false},
+		{"not", Condition{Not: &Condition{Attr: "params.unknown", Op: "present"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.condition
+			if err := c.compile(); err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			if got := c.evaluate(request, time.UTC, "test", nil); got != tt.want {
+				t.Errorf("evaluate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionCompileErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition Condition
+	}{
+		{"unknown namespace", Condition{Attr: "header.host", Op: "present"}},
+		{"unknown claim", Condition{Attr: "token.password", Op: "present"}},
+		{"unknown ref", Condition{Attr: "params.customer_id", Op: "eq", Ref: "token"}},
+		{"unknown operator", Condition{Attr: "params.customer_id", Op: "like"}},
+		{"invalid cidr", Condition{Attr: "request.ip", Op: "cidr", Values: []string{"10.0.0.0"}}},
+		{"between one value", Condition{Attr: "time.of_day", Op: "between", Values: []string{"08:00"}}},
+		{"nested", Condition{All: []Condition{{Attr: "request.ip", Op: "like"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.condition.compile(); err == nil {
+				t.Error("compile succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestDefaultPolicies(t *testing.T) {
+	claims := &AccessTokenClaims{CustomerId: "2000", Accounts: []string{"95470"}, Role: DefaultUserRole}
+	admin := &AccessTokenClaims{Role: AdminRole}
+	tests := []struct {
+		name    string
+		request AccessRequest
+		want    bool
+	}{
+		{"own customer", AccessRequest{Claims: claims, Params: map[string]string{"customer_id": "2000"}}, true},
+		{"own account", AccessRequest{Claims: claims, Params: map[string]string{"customer_id": "2000", "account_id": "95470"}}, true},
+		{"other customer", AccessRequest{Claims: claims, Params: map[string]string{"customer_id": "2001"}}, false},
+		{"other account", AccessRequest{Claims: claims, Params: map[string]string{"customer_id": "2000", "account_id": "95471"}}, false},
+		{"admin", AccessRequest{Claims: admin, Params: map[string]string{"customer_id": "2001"}}, true},
+		{"admin inheriting user", AccessRequest{Claims: admin, Roles: []string{AdminRole, DefaultUserRole}, Params: map[string]string{"customer_id": "2001"}}, true},
+		{"not targeted", AccessRequest{Claims: &AccessTokenClaims{Role: ClientRole}, Params: map[string]string{"customer_id": "2001"}}, true},
+	}
+	policies := DefaultPolicies()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policies.Evaluate(tt.request); got.Allowed != tt.want {
+				t.Errorf("Allowed = %v, want %v (%s)", got.Allowed, tt.want, got.Message)
+			}
+		})
+	}
+}
+
+func TestPolicyEffects(t *testing.T) {
+	set := &PolicySet{Policies: []Policy{
+		{Name: "office-network", Routes: []string{"Get*"}, Methods: []string{"GET"},
+			Condition: Condition{Attr: "request.ip", Op: "cidr", Values: []string{"10.0.0.0/8"}}},
+		{Name: "no-late-transactions", Effect: PolicyEffectDeny, Routes: []string{"NewTransaction"},
+			Condition: Condition{Attr: "time.of_day", Op: "between", Values: []string{"22:00", "06:00"}}},
+	}}
+	if err := set.compile(); err != nil {
+		t.Fatal(err)
+	}
+	noon := time.Date(2024, time.March, 4, 12, 0, 0, 0, time.Local)
+	night := time.Date(2024, time.March, 4, 23, 0, 0, 0, time.Local)
+	tests := []struct {
+		name       string
+		request    AccessRequest
+		wantPolicy string
+	}{
+		{"inside network", AccessRequest{RouteName: "GetCustomer", Method: "GET", ClientIp: "10.0.0.1", Time: noon}, ""},
+		{"outside network", AccessRequest{RouteName: "GetCustomer", Method: "GET", ClientIp: "203.0.113.1", Time: noon}, "office-network"},
+		{"other method", AccessRequest{RouteName: "GetCustomer", Method: "POST", ClientIp: "203.0.113.1", Time: noon}, ""},
+		{"daytime transaction", AccessRequest{RouteName: "NewTransaction", Time: noon}, ""},
+		{"late transaction", AccessRequest{RouteName: "NewTransaction", Time: night}, "no-late-transactions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := set.Evaluate(tt.request)
+			if got.Allowed != (tt.wantPolicy == "") || got.Policy != tt.wantPolicy {
+				t.Errorf("Evaluate = %+v, want rejection by %q", got, tt.wantPolicy)
+			}
+		})
+	}
+}
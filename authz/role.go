@@ -0,0 +1,285 @@
+package authz
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+)
+
+// AdminRouteNames are the routes of this server permissions can be granted
+// for, next to the routes of the protected API named in the route map.
+var AdminRouteNames = []string{
+	"RotateSigningKeys",
+	"UnlockAccounts",
+	"ManageRoles",
+	"EvaluatePolicies",
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+/*
+Role grants and denies routes, directly and through the roles it inherits
+from. It is kept in the roles table:
+
+	role varchar(32) primary key, description varchar(255) not null default ''
+
+the role_permissions table:
+
+	role varchar(32), route_name varchar(64),
+	effect varchar(5) not null default 'allow', primary key (role, route_name)
+
+and the role_inheritance table:
+
+	role varchar(32), parent_role varchar(32), primary key (role, parent_role)
+
+Route names may be patterns: "*" matches every route and a trailing "*" a
+prefix, e.g. "Get*" matches GetAllCustomers and GetCustomer.
+*/
+type Role struct {
+	Name        string `db:"role"`
+	Description string `db:"description"`
+	Permissions []string
+	Denies      []string
+	Inherits    []string
+}
+
+const (
+	// DefaultUserRole is the role of users that register themselves.
+	DefaultUserRole = "user"
+	AdminRole       = "admin"
+	// ClientRole is the role of client principals whose client has none set.
+	ClientRole = "client"
+)
+
+const (
+	PermissionAllow = "allow"
+	PermissionDeny  = "deny"
+)
+
+// Validate checks the role name, that every pattern matches one of the known
+// routes and that no route is both allowed and denied. The lists are sorted
+// and deduplicated.
+func (r *Role) Validate(routeNames []string) *errs.AppError {
+	if !roleNamePattern.MatchString(r.Name) {
+		return errs.NewValidationError("role must be 1 to 32 lowercase letters, digits, '-' or '_'")
+	}
+	var appErr *errs.AppError
+	if r.Permissions, appErr = routePatterns(r.Permissions, routeNames); appErr != nil {
+		return appErr
+	}
+	if r.Denies, appErr = routePatterns(r.Denies, routeNames); appErr != nil {
+		return appErr
+	}
+	for _, p := range r.Permissions {
+		if contains(r.Denies, p) {
+			return errs.NewValidationError(fmt.Sprintf("route %q is both allowed and denied", p))
+		}
+	}
+	r.Inherits = uniqueSorted(r.Inherits)
+	for _, parent := range r.Inherits {
+		if parent == r.Name {
+			return errs.NewValidationError("a role can not inherit from itself")
+		}
+	}
+	return nil
+}
+
+func routePatterns(patterns []string, routeNames []string) ([]string, *errs.AppError) {
+	for i, p := range patterns {
+		p = strings.TrimSpace(p)
+		if !matchesKnownRoute(p, routeNames) {
+			return nil, errs.NewValidationError(fmt.Sprintf("unknown route %q", p))
+		}
+		patterns[i] = p
+	}
+	return uniqueSorted(patterns), nil
+}
+
+func uniqueSorted(values []string) []string {
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if !contains(unique, v) {
+			unique = append(unique, v)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// matchesKnownRoute tells whether the pattern grants at least one route.
+func matchesKnownRoute(pattern string, routeNames []string) bool {
+	for _, r := range routeNames {
+		if MatchRoute(pattern, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchRoute matches a route name against a permission, which is the route
+// name itself or a pattern ending in "*".
+func MatchRoute(pattern string, routeName string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(routeName, prefix)
+	}
+	return pattern == routeName
+}
+
+// CheckRoleHierarchy verifies that the inherited roles exist and that no role
+// inherits from itself through others.
+func CheckRoleHierarchy(roles []Role) *errs.AppError {
+	byName := make(map[string]Role, len(roles))
+	for _, r := range roles {
+		byName[r.Name] = r
+	}
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(roles))
+	var visit func(name string, path []string) *errs.AppError
+	visit = func(name string, path []string) *errs.AppError {
+		switch state[name] {
+		case visiting:
+			return errs.NewValidationError("role inheritance cycle " + strings.Join(append(path, name), " > "))
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, parent := range byName[name].Inherits {
+			if _, ok := byName[parent]; !ok {
+				return errs.NewValidationError(fmt.Sprintf("role %s inherits from unknown role %s", name, parent))
+			}
+			if appErr := visit(parent, append(path, name)); appErr != nil {
+				return appErr
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for _, r := range roles {
+		if appErr := visit(r.Name, nil); appErr != nil {
+			return appErr
+		}
+	}
+	return nil
+}
+
+// RolePermissions is the authorization table the token verification checks
+// against. It is loaded from the role repository and can be reloaded while
+// requests are served.
+type RolePermissions struct {
+	mu    sync.RWMutex
+	roles map[string]Role
+}
+
+/*
+IsAuthorizedFor checks a route against the roles of a principal and the
+roles they inherit from. A deny in any of them overrides every allow,
+otherwise one allow is enough.
+*/
+func (p *RolePermissions) IsAuthorizedFor(roles []string, routeName string) bool {
+	return p.Explain(roles, routeName, nil)
+}
+
+// Explain is IsAuthorizedFor recording the resolved roles and the matching
+// permissions in the trace.
+func (p *RolePermissions) Explain(roles []string, routeName string, trace *DecisionTrace) bool {
+	routeName = strings.TrimSpace(routeName)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	effective := p.effectiveRoles(roles)
+	names := make([]string, len(effective))
+	for i, role := range effective {
+		names[i] = role.Name
+	}
+	trace.add("roles", strings.Join(roles, ", "), TracePass, "resolved with inherited roles to "+strings.Join(names, ", "))
+
+	allowed := false
+	for _, role := range effective {
+		for _, pattern := range role.Denies {
+			if MatchRoute(pattern, routeName) {
+				trace.add("deny", role.Name, TraceMatch, fmt.Sprintf("%s denies %s", pattern, routeName))
+				return false
+			}
+		}
+		for _, pattern := range role.Permissions {
+			if MatchRoute(pattern, routeName) {
+				trace.add("permission", role.Name, TraceMatch, fmt.Sprintf("%s allows %s", pattern, routeName))
+				allowed = true
+			}
+		}
+	}
+	if !allowed {
+		trace.add("permission", strings.Join(names, ", "), TraceNoMatch, "no permission allows "+routeName)
+	}
+	return allowed
+}
+
+// EffectiveRoles returns the names of the roles with all roles they inherit
+// from, each once.
+func (p *RolePermissions) EffectiveRoles(roles []string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	effective := p.effectiveRoles(roles)
+	names := make([]string, len(effective))
+	for i, role := range effective {
+		names[i] = role.Name
+	}
+	return names
+}
+
+// effectiveRoles returns the roles with all roles they inherit from, each
+// once. Unknown roles grant nothing.
+func (p *RolePermissions) effectiveRoles(names []string) []Role {
+	seen := make(map[string]bool)
+	effective := make([]Role, 0, len(names))
+	queue := append([]string{}, names...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		role, ok := p.roles[name]
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		effective = append(effective, role)
+		queue = append(queue, role.Inherits...)
+	}
+	return effective
+}
+
+// Load replaces all roles at once.
+func (p *RolePermissions) Load(roles []Role) {
+	byName := make(map[string]Role, len(roles))
+	for _, r := range roles {
+		byName[r.Name] = r
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.roles = byName
+}
+
+func NewRolePermissions(roles []Role) *RolePermissions {
+	p := &RolePermissions{}
+	p.Load(roles)
+	return p
+}
+
+// DefaultRoles are the roles the role repository is seeded with on first
+// start.
+func DefaultRoles() []Role {
+	return []Role{
+		{Name: AdminRole, Description: "Bank staff", Inherits: []string{DefaultUserRole},
+			Permissions: []string{"EvaluatePolicies", "GetAllCustomers", "ManageRoles", "NewAccount", "RotateSigningKeys", "UnlockAccounts"}},
+		{Name: DefaultUserRole, Description: "Customers", Permissions: []string{"GetCustomer", "NewTransaction"}},
+		// backend jobs authenticating with the client credentials grant, only
+		// allowed what their own role or an explicit grant allows them
+		{Name: ClientRole, Description: "Backend clients", Permissions: []string{}},
+	}
+}
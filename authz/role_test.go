@@ -0,0 +1,132 @@
+package authz
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchRoute(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		routeName string
+		want      bool
+	}{
+		{"GetCustomer", "GetCustomer", true},
+		{"GetCustomer", "GetAllCustomers", false},
+		{"Get*", "GetCustomer", true},
+		{"Get*", "GetAllCustomers", true},
+		{"Get*", "NewAccount", false},
+		{"*", "RotateSigningKeys", true},
+		{"GetCustomer*", "GetCustomer", true},
+		{"getCustomer", "GetCustomer", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.routeName, func(t *testing.T) {
+			if got := MatchRoute(tt.pattern, tt.routeName); got != tt.want {
+				t.Errorf("MatchRoute(%q, %q) = %v, want %v", tt.pattern, tt.routeName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAuthorizedFor(t *testing.T) {
+	permissions := NewRolePermissions([]Role{
+		{Name: "teller", Permissions: []string{"Get*", "NewTransaction"}, Inherits: []string{"viewer"}},
+		{Name: "viewer", Permissions: []string{"GetAccount"}},
+		{Name: "restricted", Denies: []string{"NewTransaction"}},
+		{Name: "trainee", Inherits: []string{"teller"}, Denies: []string{"GetAll*"}},
+		{Name: "root", Permissions: []string{"*"}},
+	})
+	tests := []struct {
+		name      string
+		roles     []string
+		routeName string
+		want      bool
+	}{
+		{"direct", []string{"teller"}, "NewTransaction", true},
+		{"wildcard", []string{"teller"}, "GetAllCustomers", true},
+		{"not granted", []string{"teller"}, "NewAccount", false},
+		{"inherited", []string{"viewer"}, "GetAccount", true},
+		{"parent does not inherit child", []string{"viewer"}, "NewTransaction", false},
+		{"inherited through two roles", []string{"trainee"}, "NewTransaction", true},
+		{"deny of own role over inherited allow", []string{"trainee"}, "GetAllCustomers", false},
+		{"deny of other role over allow", []string{"teller", "restricted"}, "NewTransaction", false},
+		{"deny order independent", []string{"restricted", "teller"}, "NewTransaction", false},
+		{"allow of other role", []string{"restricted", "teller"}, "GetCustomer", true},
+		{"match all", []string{"root"}, "RotateSigningKeys", true},
+		{"unknown role", []string{"ghost"}, "GetCustomer", false},
+		{"route name trimmed", []string{"teller"}, " NewTransaction ", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := permissions.IsAuthorizedFor(tt.roles, tt.routeName); got != tt.want {
+				t.Errorf("IsAuthorizedFor(%v, %q) = %v, want %v", tt.roles, tt.routeName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveRoles(t *testing.T) {
+	permissions := NewRolePermissions([]Role{
+		{Name: "a", Inherits: []string{"b", "c"}},
+		{Name: "b", Inherits: []string{"c"}},
+		{Name: "c"},
+	})
+	got := permissions.EffectiveRoles([]string{"a", "ghost"})
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EffectiveRoles = %v, want %v", got, want)
+	}
+}
+
+func TestCheckRoleHierarchy(t *testing.T) {
+	tests := []struct {
+		name    string
+		roles   []Role
+		wantErr bool
+	}{
+		{"defaults", DefaultRoles(), false},
+		{"diamond", []Role{
+			{Name: "a", Inherits: []string{"b", "c"}},
+			{Name: "b", Inherits: []string{"d"}},
+			{Name: "c", Inherits: []string{"d"}},
+			{Name: "d"},
+		}, false},
+		{"cycle", []Role{
+			{Name: "a", Inherits: []string{"b"}},
+			{Name: "b", Inherits: []string{"c"}},
+			{Name: "c", Inherits: []string{"a"}},
+		}, true},
+		{"self", []Role{{Name: "a", Inherits: []string{"a"}}}, true},
+		{"unknown parent", []Role{{Name: "a", Inherits: []string{"b"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if appErr := CheckRoleHierarchy(tt.roles); (appErr != nil) != tt.wantErr {
+				t.Errorf("CheckRoleHierarchy = %v, want error %v", appErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoleValidate(t *testing.T) {
+	routeNames := []string{"GetCustomer", "GetAllCustomers", "NewAccount"}
+	tests := []struct {
+		name    string
+		role    Role
+		wantErr bool
+	}{
+		{"valid", Role{Name: "teller", Permissions: []string{"Get*", "NewAccount"}}, false},
+		{"invalid name", Role{Name: "Teller"}, true},
+		{"unknown route", Role{Name: "teller", Permissions: []string{"DeleteCustomer"}}, true},
+		{"pattern matching nothing", Role{Name: "teller", Denies: []string{"Delete*"}}, true},
+		{"allowed and denied", Role{Name: "teller", Permissions: []string{"NewAccount"}, Denies: []string{"NewAccount"}}, true},
+		{"inherits itself", Role{Name: "teller", Inherits: []string{"teller"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if appErr := tt.role.Validate(routeNames); (appErr != nil) != tt.wantErr {
+				t.Errorf("Validate = %v, want error %v", appErr, tt.wantErr)
+			}
+		})
+	}
+}
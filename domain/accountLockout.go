@@ -0,0 +1,196 @@
+package domain
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	LoginMethodPassword = "password"
+	LoginMethodOtp      = "otp"
+)
+
+/*
+LockoutPolicy slows down guessing the credentials of a single account: once
+BackoffAfter consecutive logins failed, every further failure doubles the
+time until the next attempt is accepted, starting at BaseDelay. After
+LockAfter failures the account is locked for LockDuration, or until an admin
+unlocks it. A successful login resets the count.
+*/
+type LockoutPolicy struct {
+	BackoffAfter int
+	BaseDelay    time.Duration
+	LockAfter    int
+	LockDuration time.Duration
+}
+
+func NewLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{BackoffAfter: 3, BaseDelay: time.Second, LockAfter: 10, LockDuration: 30 * time.Minute}
+}
+
+// Delay returns how long the account is blocked after its n-th consecutive
+// failure.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	switch {
+	case failures >= p.LockAfter:
+		return p.LockDuration
+	case failures < p.BackoffAfter:
+		return 0
+	}
+	delay := p.BaseDelay << uint(failures-p.BackoffAfter)
+	if delay > p.LockDuration || delay <= 0 {
+		return p.LockDuration
+	}
+	return delay
+}
+
+/*
+AccountLockout is the count of consecutive failed logins of a user, kept in
+the account_lockouts table:
+
+	owner varchar(64) primary key, failures int not null,
+	locked_until datetime(3) null, last_failure_on datetime(3) not null
+
+Accounts are named like the owners of refresh tokens, e.g. "users:42" or
+"sanyukt_users:42", as the ids of the two tables overlap.
+*/
+type AccountLockout struct {
+	Owner       string       `db:"owner"`
+	Failures    int          `db:"failures"`
+	LockedUntil sql.NullTime `db:"locked_until"`
+}
+
+// RetryAfter returns how long logins of the account are still refused.
+func (l AccountLockout) RetryAfter(now time.Time) time.Duration {
+	if !l.LockedUntil.Valid || !l.LockedUntil.Time.After(now) {
+		return 0
+	}
+	return l.LockedUntil.Time.Sub(now)
+}
+
+/*
+LoginFailure is a failed login kept for review in the login_failures table:
+
+	id bigint auto_increment primary key, owner varchar(64) null,
+	account varchar(255), method varchar(10), reason varchar(50),
+	client_ip varchar(45), user_agent varchar(255), failed_on datetime(3)
+
+account is the username or mobile number tried, owner the account it
+belongs to as in AccountLockout, null when it belongs to nobody or the
+failure is not counted.
+*/
+type LoginFailure struct {
+	Owner     sql.NullString `db:"owner"`
+	Account   string         `db:"account"`
+	Method    string         `db:"method"`
+	Reason    string         `db:"reason"`
+	ClientIp  string         `db:"client_ip"`
+	UserAgent string         `db:"user_agent"`
+}
+
+type AccountLockoutRepository interface {
+	FindLockout(owner string) (*AccountLockout, *errs.AppError)
+	RecordFailure(failure LoginFailure) (*AccountLockout, *errs.AppError)
+	Reset(owner string) *errs.AppError
+}
+
+type AccountLockoutRepositoryDb struct {
+	client *sqlx.DB
+	policy LockoutPolicy
+}
+
+// FindLockout returns an empty lockout for accounts without failures.
+func (d AccountLockoutRepositoryDb) FindLockout(owner string) (*AccountLockout, *errs.AppError) {
+	lockout := AccountLockout{Owner: owner}
+	sqlSelect := "select owner, failures, locked_until from account_lockouts where owner = ?"
+	if err := d.client.Get(&lockout, sqlSelect, owner); err != nil && err != sql.ErrNoRows {
+		logger.Error("Error while loading account lockout: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	return &lockout, nil
+}
+
+/*
+RecordFailure logs the failed login and, when it belongs to a user, counts it
+and blocks the account as long as the policy says. Reaching the lockout
+threshold is logged as a security event.
+*/
+func (d AccountLockoutRepositoryDb) RecordFailure(f LoginFailure) (*AccountLockout, *errs.AppError) {
+	tx, err := d.client.Beginx()
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	sqlInsert := `insert into login_failures (owner, account, method, reason, client_ip, user_agent, failed_on)
+		values (?, ?, ?, ?, ?, ?, ?)`
+	if _, err = tx.Exec(sqlInsert, f.Owner, f.Account, f.Method, f.Reason, f.ClientIp, truncate(f.UserAgent, 255), now); err != nil {
+		logger.Error("Error while recording login failure: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+
+	lockout := AccountLockout{}
+	if f.Owner.Valid {
+		sqlUpsert := `insert into account_lockouts (owner, failures, last_failure_on) values (?, 1, ?)
+			on duplicate key update failures = failures + 1, last_failure_on = values(last_failure_on)`
+		if _, err = tx.Exec(sqlUpsert, f.Owner, now); err != nil {
+			logger.Error("Error while counting login failure: " + err.Error())
+			return nil, errs.NewUnexpectedError("unexpected database error")
+		}
+		sqlSelect := "select owner, failures, locked_until from account_lockouts where owner = ?"
+		if err = tx.Get(&lockout, sqlSelect, f.Owner); err != nil {
+			logger.Error("Error while counting login failure: " + err.Error())
+			return nil, errs.NewUnexpectedError("unexpected database error")
+		}
+		if delay := d.policy.Delay(lockout.Failures); delay > 0 {
+			lockout.LockedUntil = sql.NullTime{Time: now.Add(delay), Valid: true}
+			sqlUpdate := "update account_lockouts set locked_until = ? where owner = ?"
+			if _, err = tx.Exec(sqlUpdate, lockout.LockedUntil, f.Owner); err != nil {
+				logger.Error("Error while locking account: " + err.Error())
+				return nil, errs.NewUnexpectedError("unexpected database error")
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	if lockout.Failures == d.policy.LockAfter {
+		logger.Warn("Security event: account locked after failed logins",
+			zap.String("event", "account_locked"),
+			zap.String("owner", f.Owner.String),
+			zap.String("client_ip", f.ClientIp))
+	}
+	return &lockout, nil
+}
+
+// Reset clears the failures of an account, after a successful login or when
+// an admin unlocks it.
+func (d AccountLockoutRepositoryDb) Reset(owner string) *errs.AppError {
+	sqlDelete := "delete from account_lockouts where owner = ?"
+	if _, err := d.client.Exec(sqlDelete, owner); err != nil {
+		logger.Error("Error while resetting account lockout: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+func NewAccountLockoutRepository(client *sqlx.DB, policy LockoutPolicy) AccountLockoutRepositoryDb {
+	return AccountLockoutRepositoryDb{client, policy}
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -2,174 +2,465 @@ package domain
 
 import (
 	"context"
-	"crypto/rand"
 	"database/sql"
 	"fmt"
-	"io"
 	"log"
 
-	"sanyuktgolang/errs"
-	"sanyuktgolang/logger"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
 type AuthRepository interface {
-	FindBy(username string, password string) (*Login, *errs.AppError)
+	FindByUsername(username string) (*Login, *errs.AppError)
+	FindLoginById(userId int64) (*Login, *errs.AppError)
+	FindLoginBySanyuktUserId(sanyuktUserId int64) (*Login, *errs.AppError)
+	UpdatePasswordHash(userId int64, passwordHash string) *errs.AppError
+	Register(registration Registration) (*Login, *errs.AppError)
+	SavePendingRegistration(registrationId string, registration Registration) *errs.AppError
+	CompleteRegistration(registrationId string, mobile string) (*Login, *errs.AppError)
 	VerifyOtp(mobile string, otp string) (*Users, *errs.AppError)
 	FindByMobile(mobile string) (*Users, *errs.AppError)
-	GenerateAndSaveRefreshTokenToStore(authToken AuthToken) (string, *errs.AppError)
-	RefreshTokenExists(refreshToken string) *errs.AppError
+	FindUserIdByMobile(mobile string) (int64, *errs.AppError)
+	SaveOtp(mobile string, userId int64, code string) *errs.AppError
+	FindUserById(userId string) (*Users, *errs.AppError)
+	SaveRefreshTokenToStore(refreshToken string, familyId string, owner string) *errs.AppError
+	FindRefreshToken(refreshToken string) (*RefreshTokenRecord, *errs.AppError)
+	RotateRefreshToken(refreshToken string, next string, familyId string) *errs.AppError
+	RevokeRefreshTokenFamily(familyId string) *errs.AppError
+	RevokeRefreshToken(refreshToken string) *errs.AppError
+	RevokeRefreshTokensOf(owner string) *errs.AppError
 }
 
 type AuthRepositoryDb struct {
-	client *sqlx.DB
+	client    *sqlx.DB
+	otpPolicy OtpPolicy
+	otpHasher OtpHasher
 }
 
-func (d AuthRepositoryDb) RefreshTokenExists(refreshToken string) *errs.AppError {
-	sqlSelect := "select refresh_token from refresh_token_store where refresh_token = ?"
-	var token string
-	err := d.client.Get(&token, sqlSelect, refreshToken)
+func (d AuthRepositoryDb) FindRefreshToken(refreshToken string) (*RefreshTokenRecord, *errs.AppError) {
+	sqlSelect := "select refresh_token, family_id, owner, status from refresh_token_store where refresh_token = ?"
+	var record RefreshTokenRecord
+	err := d.client.Get(&record, sqlSelect, refreshToken)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return errs.NewAuthenticationError("refresh token not registered in the store")
+			return nil, errs.NewAuthenticationError("refresh token not registered in the store")
 		} else {
 			logger.Error("Unexpected database error: " + err.Error())
-			return errs.NewUnexpectedError("unexpected database error")
+			return nil, errs.NewUnexpectedError("unexpected database error")
 		}
 	}
+	return &record, nil
+}
+
+func (d AuthRepositoryDb) SaveRefreshTokenToStore(refreshToken string, familyId string, owner string) *errs.AppError {
+	sqlInsert := "insert into refresh_token_store (refresh_token, family_id, owner, status) values (?, ?, ?, ?)"
+	_, err := d.client.Exec(sqlInsert, refreshToken, familyId, owner, RefreshTokenActive)
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
 	return nil
 }
 
-func (d AuthRepositoryDb) GenerateAndSaveRefreshTokenToStore(authToken AuthToken) (string, *errs.AppError) {
-	// generate the refresh token
-	var appErr *errs.AppError
-	var refreshToken string
-	if refreshToken, appErr = authToken.newRefreshToken(); appErr != nil {
-		return "", appErr
+/*
+RotateRefreshToken marks the presented token as rotated and stores next as the
+active token of the family, owned by the owner of the presented token. A
+conflict error is returned when the presented
+token was no longer active, i.e. a concurrent request already consumed it.
+*/
+func (d AuthRepositoryDb) RotateRefreshToken(refreshToken string, next string, familyId string) *errs.AppError {
+	tx, err := d.client.Beginx()
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
 	}
+	defer tx.Rollback()
 
-	// store it in the store
-	sqlInsert := "insert into refresh_token_store (refresh_token) values (?)"
-	_, err := d.client.Exec(sqlInsert, refreshToken)
+	sqlUpdate := "update refresh_token_store set status = ?, family_id = ?, rotated_on = now() where refresh_token = ? and status = ?"
+	result, err := tx.Exec(sqlUpdate, RefreshTokenRotated, familyId, refreshToken, RefreshTokenActive)
 	if err != nil {
 		logger.Error("unexpected database error: " + err.Error())
-		return "", errs.NewUnexpectedError("unexpected database error")
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errs.NewConflictError("refresh token already used")
+	}
+
+	sqlInsert := `insert into refresh_token_store (refresh_token, family_id, owner, status)
+		select ?, ?, owner, ? from refresh_token_store where refresh_token = ?`
+	if _, err = tx.Exec(sqlInsert, next, familyId, RefreshTokenActive, refreshToken); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
 	}
-	return refreshToken, nil
+
+	if err = tx.Commit(); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
 }
 
-func (d AuthRepositoryDb) FindBy(username, password string) (*Login, *errs.AppError) {
+func (d AuthRepositoryDb) RevokeRefreshTokenFamily(familyId string) *errs.AppError {
+	sqlUpdate := "update refresh_token_store set status = ? where family_id = ?"
+	_, err := d.client.Exec(sqlUpdate, RefreshTokenRevoked, familyId)
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+// RevokeRefreshTokensOf revokes every refresh token of a user, see
+// Login.TokenOwner and Users.TokenOwner.
+func (d AuthRepositoryDb) RevokeRefreshTokensOf(owner string) *errs.AppError {
+	sqlUpdate := "update refresh_token_store set status = ? where owner = ?"
+	if _, err := d.client.Exec(sqlUpdate, RefreshTokenRevoked, owner); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+func (d AuthRepositoryDb) RevokeRefreshToken(refreshToken string) *errs.AppError {
+	sqlUpdate := "update refresh_token_store set status = ? where refresh_token = ?"
+	_, err := d.client.Exec(sqlUpdate, RefreshTokenRevoked, refreshToken)
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+const sqlSelectLogin = `SELECT l.user_id, l.sanyukt_user_id, l.username, l.password, l.customer_id, l.role, u.user_mobile, o.otp_verified,
+		(SELECT group_concat(r.role ORDER BY r.role) FROM user_roles r WHERE r.user_id = l.user_id) AS roles FROM users l
+		LEFT JOIN sanyukt_users u ON u.user_id = l.sanyukt_user_id
+		LEFT JOIN users_otp o ON o.user_id = l.sanyukt_user_id`
+
+func (d AuthRepositoryDb) FindByUsername(username string) (*Login, *errs.AppError) {
 	var login Login
 
-	sqlVerify := `SELECT username, customer_id, role FROM users WHERE username = ? and password = ?`
-	logger.Debug(fmt.Sprintf("Sql %s: ...", sqlVerify))
-	err := d.client.Get(&login, sqlVerify, username, password)
+	sqlSelect := sqlSelectLogin + ` WHERE l.username = ?`
+	err := d.client.Get(&login, sqlSelect, username)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errs.NewAuthenticationError("invalid credentials")
+			return nil, errs.NewNotFoundError("user not found")
 		} else {
-			logger.Error("Error while verifying login request from database: " + err.Error())
+			logger.Error("Error while loading login from database: " + err.Error())
 			return nil, errs.NewUnexpectedError("Unexpected database error")
 		}
 	}
 	return &login, nil
 }
 
-func (d AuthRepositoryDb) VerifyOtp(mobile, otp string) (*Users, *errs.AppError) {
-	var login Users
+func (d AuthRepositoryDb) FindLoginById(userId int64) (*Login, *errs.AppError) {
+	var login Login
+	if err := d.client.Get(&login, sqlSelectLogin+" WHERE l.user_id = ?", userId); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errs.NewNotFoundError("user not found")
+		}
+		logger.Error("Error while loading login from database: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	return &login, nil
+}
 
-	sqlVerify := `SELECT user_id FROM users_otp WHERE user_mobile = ? and user_otp = ?`
-	logger.Debug(fmt.Sprintf("Sql %s: ...", sqlVerify))
-	err := d.client.Get(&login, sqlVerify, mobile, otp)
+// FindLoginBySanyuktUserId returns the login the mobile number of the
+// sanyukt_users row is linked to.
+func (d AuthRepositoryDb) FindLoginBySanyuktUserId(sanyuktUserId int64) (*Login, *errs.AppError) {
+	var login Login
+	if err := d.client.Get(&login, sqlSelectLogin+" WHERE l.sanyukt_user_id = ?", sanyuktUserId); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errs.NewNotFoundError("user not found")
+		}
+		logger.Error("Error while loading login from database: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	return &login, nil
+}
+
+// UpdatePasswordHash replaces the stored password of a user, e.g. when a
+// legacy password is rehashed on login.
+func (d AuthRepositoryDb) UpdatePasswordHash(userId int64, passwordHash string) *errs.AppError {
+	sqlUpdate := "update users set password = ? where user_id = ?"
+	_, err := d.client.Exec(sqlUpdate, passwordHash, userId)
+	if err != nil {
+		logger.Error("Error while updating password hash: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+// Register creates the login of a new user without a mobile number. Logins
+// are not customers, their customer_id stays null.
+func (d AuthRepositoryDb) Register(r Registration) (*Login, *errs.AppError) {
+	sqlInsert := "insert into users (username, password, role) values (?, ?, ?)"
+	result, err := d.client.Exec(sqlInsert, r.Username, r.PasswordHash, r.Role)
+	if err != nil {
+		return nil, registrationError(err)
+	}
+	userId, err := result.LastInsertId()
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	return d.FindLoginById(userId)
+}
+
+/*
+SavePendingRegistration keeps a registration with a mobile number until the
+OTP sent to the number is verified, no login exists before that. Pending
+registrations are rows of the pending_registrations table:
+
+	registration_id char(32) primary key, username varchar(64) not null,
+	password varchar(255) not null, user_mobile varchar(20) not null,
+	role varchar(20) not null, created_on datetime not null
+*/
+func (d AuthRepositoryDb) SavePendingRegistration(registrationId string, r Registration) *errs.AppError {
+	sqlInsert := `insert into pending_registrations (registration_id, username, password, user_mobile, role, created_on)
+		values (?, ?, ?, ?, ?, now())`
+	if _, err := d.client.Exec(sqlInsert, registrationId, r.Username, r.PasswordHash, r.Mobile, r.Role); err != nil {
+		logger.Error("Error while saving pending registration: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+/*
+CompleteRegistration creates the login of a pending registration once the
+OTP sent to its mobile number was verified, linked to the sanyukt_users row
+of the number. Registrations expire with the OTP sent for them, and a number
+can only be linked to a single login.
+*/
+func (d AuthRepositoryDb) CompleteRegistration(registrationId string, mobile string) (*Login, *errs.AppError) {
+	tx, err := d.client.Beginx()
 	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	defer tx.Rollback()
+
+	var r struct {
+		Username     string `db:"username"`
+		PasswordHash string `db:"password"`
+		Role         string `db:"role"`
+	}
+	sqlSelect := `select username, password, role from pending_registrations
+		where registration_id = ? and user_mobile = ? and created_on > now() - interval ? second for update`
+	if err = tx.Get(&r, sqlSelect, registrationId, mobile, int64(d.otpPolicy.TTL.Seconds())); err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errs.NewAuthenticationError("Invalid Otp")
+			return nil, errs.NewNotFoundError("registration not found or expired")
+		}
+		logger.Error("Error while loading pending registration: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	var sanyuktUserId int64
+	if err = tx.Get(&sanyuktUserId, "select user_id from sanyukt_users where user_mobile = ? for update", mobile); err != nil {
+		logger.Error("Error while loading user by mobile: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	sqlUpdate := "update sanyukt_users set user_name = coalesce(user_name, ?) where user_id = ?"
+	if _, err = tx.Exec(sqlUpdate, r.Username, sanyuktUserId); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	sqlInsert := "insert into users (sanyukt_user_id, username, password, role) values (?, ?, ?, ?)"
+	result, err := tx.Exec(sqlInsert, sanyuktUserId, r.Username, r.PasswordHash, r.Role)
+	if err != nil {
+		return nil, registrationError(err)
+	}
+	userId, err := result.LastInsertId()
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	if _, err = tx.Exec("delete from pending_registrations where registration_id = ?", registrationId); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+
+	var login Login
+	if err = tx.Get(&login, sqlSelectLogin+" WHERE l.user_id = ?", userId); err != nil {
+		logger.Error("Error while loading registered login: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	if err = tx.Commit(); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	return &login, nil
+}
+
+// DeleteExpiredRegistrations removes the pending registrations whose OTP
+// expired without being verified.
+func (d AuthRepositoryDb) DeleteExpiredRegistrations() {
+	sqlDelete := "delete from pending_registrations where created_on < now() - interval ? second"
+	if _, err := d.client.Exec(sqlDelete, int64(d.otpPolicy.TTL.Seconds())); err != nil {
+		logger.Error("Error while deleting expired registrations: " + err.Error())
+	}
+}
+
+// registrationError reports unique key violations, a username or mobile number
+// registered concurrently, as conflicts.
+func registrationError(err error) *errs.AppError {
+	if isDuplicateEntry(err) {
+		return errs.NewConflictError("username or mobile number already registered")
+	}
+	logger.Error("Error while registering user: " + err.Error())
+	return errs.NewUnexpectedError("unexpected database error")
+}
+
+func isDuplicateEntry(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && mysqlErr.Number == 1062
+}
+
+/*
+VerifyOtp checks the code last issued for the mobile number. Every wrong code
+counts as a failed attempt, once the policy's maximum is reached the code is
+locked. A matching code is consumed, so it can only be used once, and marks the
+mobile number as verified.
+*/
+func (d AuthRepositoryDb) VerifyOtp(mobile, code string) (*Users, *errs.AppError) {
+	tx, err := d.client.Beginx()
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	defer tx.Rollback()
+
+	var otp Otp
+	sqlSelect := `SELECT user_id, user_mobile, user_otp, failed_attempts, consumed_on,
+		timestampdiff(second, created_on, now()) AS age_seconds FROM users_otp WHERE user_mobile = ? FOR UPDATE`
+	if err = tx.Get(&otp, sqlSelect, mobile); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewOtpInvalidError()
+		}
+		logger.Error("Error while loading otp from database: " + err.Error())
+		return nil, errs.NewUnexpectedError("Unexpected database error")
+	}
+	if otp.IsLocked(d.otpPolicy) {
+		return nil, NewOtpLockedError()
+	}
+	if otp.IsExpired(d.otpPolicy) {
+		return nil, NewOtpExpiredError()
+	}
+
+	if !otp.Matches(code, d.otpHasher) {
+		sqlUpdate := "UPDATE users_otp SET failed_attempts = failed_attempts + 1 WHERE user_mobile = ?"
+		if _, err = tx.Exec(sqlUpdate, mobile); err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			logger.Error("Error while counting failed otp attempt: " + err.Error())
+			return nil, errs.NewUnexpectedError("Unexpected database error")
+		}
+		otp.FailedAttempts++
+		if otp.IsLocked(d.otpPolicy) {
+			return nil, NewOtpLockedError()
+		}
+		return nil, NewOtpInvalidError()
+	}
+
+	sqlUpdate := "UPDATE users_otp SET otp_verified = true, consumed_on = now() WHERE user_mobile = ?"
+	if _, err = tx.Exec(sqlUpdate, mobile); err != nil {
+		logger.Error("Error while consuming otp: " + err.Error())
+		return nil, errs.NewUnexpectedError("Unexpected database error")
+	}
+	var user Users
+	sqlUser := "SELECT user_id, user_name, user_mobile, user_role FROM sanyukt_users WHERE user_id = ?"
+	if err = tx.Get(&user, sqlUser, otp.UserId); err != nil {
+		logger.Error("Error while loading user from database: " + err.Error())
+		return nil, errs.NewUnexpectedError("Unexpected database error")
+	}
+	if err = tx.Commit(); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return nil, errs.NewUnexpectedError("Unexpected database error")
+	}
+	return &user, nil
+}
+
+func (d AuthRepositoryDb) FindUserById(userId string) (*Users, *errs.AppError) {
+	var user Users
+
+	sqlSelect := `SELECT u.user_id, u.user_name, u.user_mobile, u.user_role, o.otp_verified FROM sanyukt_users u
+		LEFT JOIN users_otp o ON o.user_id = u.user_id WHERE u.user_id = ?`
+	err := d.client.Get(&user, sqlSelect, userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errs.NewNotFoundError("user not found")
 		} else {
-			logger.Error("Error while verifying login request from database: " + err.Error())
+			logger.Error("Error while loading user from database: " + err.Error())
 			return nil, errs.NewUnexpectedError("Unexpected database error")
 		}
 	}
-	return &login, nil
+	return &user, nil
 }
 
+// FindByMobile loads the user with the mobile number, creating the user on
+// the first OTP request for the number.
 func (d AuthRepositoryDb) FindByMobile(mobile string) (*Users, *errs.AppError) {
 	var user Users
 
-	sqlVerify := `SELECT user_id,user_name,user_mobile,user_role FROM sanyukt_users WHERE user_mobile = ?`
+	sqlVerify := `SELECT user_id,user_name,user_mobile,user_email,user_role FROM sanyukt_users WHERE user_mobile = ?`
 	logger.Debug(fmt.Sprintf("Sql %s: ...", sqlVerify))
 	err := d.client.Get(&user, sqlVerify, mobile)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			//Create user
-			user, err := d.CreateUser(mobile)
-			if err != nil {
-				return nil, err
-			} else {
-				_, err := d.GenerateOtp(mobile, user.Id)
-				if err != nil {
-					return nil, errs.NewAuthenticationError("invalid otp credentials")
-				} else {
-					return user, nil
-				}
-			}
+			return d.CreateUser(mobile)
 		} else {
 			logger.Error("Error while verifying login request from database: " + err.Error())
 			return nil, errs.NewUnexpectedError("Unexpected database error")
 		}
 	}
+	return &user, nil
+}
 
-	_, errs := d.GenerateOtp(mobile, user.Id)
-	if errs != nil {
-		return nil, errs
-	} else {
-		return &user, nil
+// FindUserIdByMobile looks the user up without creating it.
+func (d AuthRepositoryDb) FindUserIdByMobile(mobile string) (int64, *errs.AppError) {
+	var userId int64
+	err := d.client.Get(&userId, "SELECT user_id FROM sanyukt_users WHERE user_mobile = ?", mobile)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, errs.NewNotFoundError("user not found")
+		}
+		logger.Error("Error while loading user from database: " + err.Error())
+		return 0, errs.NewUnexpectedError("Unexpected database error")
 	}
-
+	return userId, nil
 }
-func (d AuthRepositoryDb) GenerateOtp(mobile string, userId int64) (bool, *errs.AppError) {
+
+// SaveOtp stores the hash of a newly issued code for the mobile number,
+// replacing the previous code.
+func (d AuthRepositoryDb) SaveOtp(mobile string, userId int64, code string) *errs.AppError {
 	isPresent, err := d.isUserOtpPresent(mobile)
 	if err != nil {
-		return false, err
+		return err
 	}
 	if isPresent {
-		isComplete, err := d.updateOtpForUser(mobile)
-		return isComplete, err
+		return d.updateOtpForUser(mobile, code)
 	} else {
 		sql := `INSERT INTO users_otp  (user_mobile,user_otp,otp_verified,user_id) VALUES (?,?,false,?)`
-		insertResult, err := d.client.ExecContext(context.Background(), sql, mobile, getRandomSixDigit(), userId)
-		logger.Error(sql)
+		_, err := d.client.ExecContext(context.Background(), sql, mobile, d.otpHasher.Hash(mobile, code), userId)
 		if err != nil {
 			logger.Error(err.Error())
-			return false, errs.NewAuthenticationError("Unable to insert otp")
-		}
-		id, err := insertResult.LastInsertId()
-		if err != nil {
-			log.Fatalf("impossible to retrieve last inserted otp id: %s", err)
-			return false, errs.NewAuthenticationError("Impossible to retrieve last inserted otp id")
+			return errs.NewAuthenticationError("Unable to insert otp")
 		}
-		log.Printf("inserted id: %d", id)
-
-		return true, nil
+		return nil
 	}
 }
 
-func (d AuthRepositoryDb) updateOtpForUser(mobile string) (bool, *errs.AppError) {
-	sql := `UPDATE users_otp SET user_otp = ? , created_on=now(),updated_on=now() where user_mobile=?`
-	insertResult, err := d.client.ExecContext(context.Background(), sql, getRandomSixDigit(), mobile)
-	logger.Error(sql)
+func (d AuthRepositoryDb) updateOtpForUser(mobile string, code string) *errs.AppError {
+	sql := `UPDATE users_otp SET user_otp = ? , created_on=now(),updated_on=now(),failed_attempts=0,consumed_on=null where user_mobile=?`
+	_, err := d.client.ExecContext(context.Background(), sql, d.otpHasher.Hash(mobile, code), mobile)
 	if err != nil {
 		logger.Error(err.Error())
-		return false, errs.NewAuthenticationError("Unable to insert otp")
+		return errs.NewAuthenticationError("Unable to insert otp")
 	}
-	id, err := insertResult.LastInsertId()
-	if err != nil {
-		log.Fatalf("impossible to retrieve last inserted otp id: %s", err)
-		return false, errs.NewAuthenticationError("Impossible to retrieve last inserted otp id")
-	}
-	log.Printf("inserted id: %d", id)
-
-	return true, nil
+	return nil
 }
 
 func (d AuthRepositoryDb) isUserOtpPresent(mobile string) (bool, *errs.AppError) {
@@ -206,21 +497,23 @@ func (d AuthRepositoryDb) CreateUser(mobile string) (*Users, *errs.AppError) {
 	return &Users{Id: id, Mobile: mobile}, nil
 }
 
-func getRandomSixDigit() string {
-
-	var table = [...]byte{'1', '2', '3', '4', '5', '6', '7', '8', '9', '0'}
-	max := 6
-	b := make([]byte, max)
-	n, err := io.ReadAtLeast(rand.Reader, b, max)
-	if n != max {
-		panic(err)
-	}
-	for i := 0; i < len(b); i++ {
-		b[i] = table[int(b[i])%len(table)]
-	}
-	return string(b)
+// HashPlaintextOtps hashes the codes stored before OTPs were hashed.
+func HashPlaintextOtps(hasher OtpHasher) Migration {
+	return Migration{Id: "hash-plaintext-otps", Apply: func(tx *sqlx.Tx) error {
+		var otps []Otp
+		if err := tx.Select(&otps, "SELECT user_mobile, user_otp FROM users_otp WHERE char_length(user_otp) < ?", 64); err != nil {
+			return err
+		}
+		for _, otp := range otps {
+			sqlUpdate := "UPDATE users_otp SET user_otp = ? WHERE user_mobile = ?"
+			if _, err := tx.Exec(sqlUpdate, hasher.Hash(otp.Mobile, otp.Code), otp.Mobile); err != nil {
+				return err
+			}
+		}
+		return nil
+	}}
 }
 
-func NewAuthRepository(client *sqlx.DB) AuthRepositoryDb {
-	return AuthRepositoryDb{client}
+func NewAuthRepository(client *sqlx.DB, otpPolicy OtpPolicy, otpHasher OtpHasher) AuthRepositoryDb {
+	return AuthRepositoryDb{client, otpPolicy, otpHasher}
 }
@@ -1,18 +1,22 @@
 package domain
 
 import (
-	"sanyuktgolang/errs"
-	"sanyuktgolang/logger"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
 type AuthToken struct {
-	token *jwt.Token
+	token  *jwt.Token
+	signer Signer
 }
 
 func (t AuthToken) NewAccessToken() (string, *errs.AppError) {
-	signedString, err := t.token.SignedString([]byte(HMAC_SAMPLE_SECRET))
+	signedString, err := t.signer.Sign(t.token)
 	if err != nil {
 		logger.Error("Failed while signing access token: " + err.Error())
 		return "", errs.NewUnexpectedError("cannot generate access token")
@@ -20,11 +24,19 @@ func (t AuthToken) NewAccessToken() (string, *errs.AppError) {
 	return signedString, nil
 }
 
-func (t AuthToken) newRefreshToken() (string, *errs.AppError) {
-	c := t.token.Claims.(AccessTokenClaims)
-	refreshClaims := c.RefreshTokenClaims()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	signedString, err := token.SignedString([]byte(HMAC_SAMPLE_SECRET))
+// newRefreshToken issues a token of the family started at authTime, expiring
+// after ttl but no later than REFRESH_TOKEN_MAX_DURATION after authTime.
+func (t AuthToken) newRefreshToken(authTime time.Time, ttl time.Duration) (string, *errs.AppError) {
+	c := t.token.Claims.(authz.AccessTokenClaims)
+	refreshClaims := newRefreshTokenClaims(c)
+	refreshClaims.AuthTime = authTime.Unix()
+	expiresAt := time.Now().Add(ttl)
+	if familyEnd := authTime.Add(REFRESH_TOKEN_MAX_DURATION); expiresAt.After(familyEnd) {
+		expiresAt = familyEnd
+	}
+	refreshClaims.ExpiresAt = expiresAt.Unix()
+	token := jwt.NewWithClaims(t.signer.Method(), refreshClaims)
+	signedString, err := t.signer.Sign(token)
 	if err != nil {
 		logger.Error("Failed while signing refresh token: " + err.Error())
 		return "", errs.NewUnexpectedError("cannot generate refresh token")
@@ -32,21 +44,10 @@ func (t AuthToken) newRefreshToken() (string, *errs.AppError) {
 	return signedString, nil
 }
 
-func NewAuthToken(claims AccessTokenClaims) AuthToken {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return AuthToken{token: token}
-}
-
-func NewAccessTokenFromRefreshToken(refreshToken string) (string, *errs.AppError) {
-	token, err := jwt.ParseWithClaims(refreshToken, &RefreshTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(HMAC_SAMPLE_SECRET), nil
-	})
-	if err != nil {
-		return "", errs.NewAuthenticationError("invalid or expired refresh token")
-	}
-	r := token.Claims.(*RefreshTokenClaims)
-	accessTokenClaims := r.AccessTokenClaims()
-	authToken := NewAuthToken(accessTokenClaims)
-
-	return authToken.NewAccessToken()
+func NewAuthToken(claims authz.AccessTokenClaims, signer Signer) AuthToken {
+	claims.TokenType = authz.TokenTypeAccess
+	claims.Id = NewRandomId()
+	claims.IssuedAt = time.Now().Unix()
+	token := jwt.NewWithClaims(signer.Method(), claims)
+	return AuthToken{token: token, signer: signer}
 }
@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const AUTHORIZATION_CODE_DURATION = time.Minute
+
+const CodeChallengeMethodS256 = "S256"
+
+/*
+AuthorizationCode is an OAuth authorization code as kept in the
+authorization_codes table:
+
+	code_hash char(64) primary key, client_id varchar(64),
+	redirect_uri varchar(512), username varchar(64), scope varchar(255),
+	nonce varchar(255), code_challenge varchar(128), auth_time datetime,
+	expires_on datetime, used tinyint(1) default 0, family_id varchar(32) null
+
+Only the SHA-256 of the code is stored, the code itself is handed to the
+client once. family_id is the refresh token family issued for the code.
+*/
+type AuthorizationCode struct {
+	CodeHash      string         `db:"code_hash"`
+	ClientId      string         `db:"client_id"`
+	RedirectUri   string         `db:"redirect_uri"`
+	Username      string         `db:"username"`
+	Scope         string         `db:"scope"`
+	Nonce         string         `db:"nonce"`
+	CodeChallenge string         `db:"code_challenge"`
+	AuthTime      time.Time      `db:"auth_time"`
+	ExpiresOn     time.Time      `db:"expires_on"`
+	FamilyId      sql.NullString `db:"family_id"`
+}
+
+func (c AuthorizationCode) IsExpired() bool {
+	return time.Now().After(c.ExpiresOn)
+}
+
+// IsValidCodeVerifier checks the PKCE verifier against the S256 challenge
+// the authorization request was made with.
+func (c AuthorizationCode) IsValidCodeVerifier(verifier string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(c.CodeChallenge)) == 1
+}
+
+func (c AuthorizationCode) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HashAuthorizationCode returns the form a code is stored and looked up in.
+func HashAuthorizationCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+type AuthorizationCodeRepository interface {
+	Save(code AuthorizationCode) *errs.AppError
+	Consume(codeHash string, familyId string, verify func(AuthorizationCode) *errs.AppError) (*AuthorizationCode, *errs.AppError)
+}
+
+type AuthorizationCodeRepositoryDb struct {
+	client *sqlx.DB
+}
+
+func (d AuthorizationCodeRepositoryDb) Save(code AuthorizationCode) *errs.AppError {
+	sqlInsert := `insert into authorization_codes (code_hash, client_id, redirect_uri, username, scope, nonce,
+		code_challenge, auth_time, expires_on, used) values (?, ?, ?, ?, ?, ?, ?, ?, ?, false)`
+	_, err := d.client.Exec(sqlInsert, code.CodeHash, code.ClientId, code.RedirectUri, code.Username, code.Scope,
+		code.Nonce, code.CodeChallenge, code.AuthTime, code.ExpiresOn)
+	if err != nil {
+		logger.Error("Error while saving authorization code: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+/*
+Consume marks the code as used, records the token family about to be issued
+for it and returns it. The code is only consumed when verify, checking it
+against the token request, passes; otherwise its error is returned and the
+code is left untouched, so a request that could not have been made by the
+client does not burn it. Codes are single use, a code that was already
+exchanged is returned along with a conflict error, so the caller can treat it
+as a replay and revoke the family issued for it.
+*/
+func (d AuthorizationCodeRepositoryDb) Consume(codeHash string, familyId string, verify func(AuthorizationCode) *errs.AppError) (*AuthorizationCode, *errs.AppError) {
+	tx, err := d.client.Beginx()
+	if err != nil {
+		logger.Error("Error while consuming authorization code: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	defer tx.Rollback()
+
+	var code struct {
+		AuthorizationCode
+		Used bool `db:"used"`
+	}
+	sqlSelect := `select code_hash, client_id, redirect_uri, username, scope, nonce, code_challenge, auth_time,
+		expires_on, used, family_id from authorization_codes where code_hash = ? for update`
+	if err = tx.Get(&code, sqlSelect, codeHash); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errs.NewAuthenticationError("unknown authorization code")
+		}
+		logger.Error("Error while consuming authorization code: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	if appErr := verify(code.AuthorizationCode); appErr != nil {
+		return nil, appErr
+	}
+	if code.Used {
+		return &code.AuthorizationCode, errs.NewConflictError("authorization code already used")
+	}
+
+	sqlUpdate := "update authorization_codes set used = true, family_id = ? where code_hash = ?"
+	if _, err = tx.Exec(sqlUpdate, familyId, codeHash); err != nil {
+		logger.Error("Error while consuming authorization code: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	if err = tx.Commit(); err != nil {
+		logger.Error("Error while consuming authorization code: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	code.FamilyId = sql.NullString{String: familyId, Valid: true}
+	return &code.AuthorizationCode, nil
+}
+
+func NewAuthorizationCodeRepository(client *sqlx.DB) AuthorizationCodeRepositoryDb {
+	return AuthorizationCodeRepositoryDb{client}
+}
@@ -0,0 +1,25 @@
+package domain
+
+import "testing"
+
+func TestIsValidCodeVerifier(t *testing.T) {
+	// RFC 7636 appendix B
+	code := AuthorizationCode{CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"}
+	tests := []struct {
+		name     string
+		verifier string
+		want     bool
+	}{
+		{"rfc 7636 verifier", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", true},
+		{"other verifier", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXl", false},
+		{"challenge as verifier", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", false},
+		{"empty verifier", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := code.IsValidCodeVerifier(tt.verifier); got != tt.want {
+				t.Errorf("IsValidCodeVerifier(%q) = %v, want %v", tt.verifier, got, tt.want)
+			}
+		})
+	}
+}
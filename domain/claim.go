@@ -3,83 +3,103 @@ package domain
 import (
 	"time"
 
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+
 	"github.com/dgrijalva/jwt-go"
 )
 
-const HMAC_SAMPLE_SECRET = "hmacSampleSecret"
 const ACCESS_TOKEN_DURATION = time.Hour
 const REFRESH_TOKEN_DURATION = time.Hour * 24 * 30
 
+// REFRESH_TOKEN_MAX_DURATION is how long after the login the refresh tokens
+// it started can be rotated, however often they are.
+const REFRESH_TOKEN_MAX_DURATION = time.Hour * 24 * 90
+const ID_TOKEN_DURATION = time.Hour
+
 type RefreshTokenClaims struct {
 	TokenType  string   `json:"token_type"`
+	UserId     string   `json:"uid,omitempty"`
 	CustomerId string   `json:"cid"`
 	Accounts   []string `json:"accounts"`
 	Username   string   `json:"un"`
+	ClientId   string   `json:"client_id,omitempty"`
 	Role       string   `json:"role"`
+	Roles      []string `json:"roles,omitempty"`
+	Scope      string   `json:"scope,omitempty"`
+	// when the login that started the token family happened
+	AuthTime int64 `json:"auth_time,omitempty"`
 	jwt.StandardClaims
 }
 
-type AccessTokenClaims struct {
-	CustomerId string   `json:"customer_id"`
-	Accounts   []string `json:"accounts"`
-	Username   string   `json:"username"`
-	Role       string   `json:"role"`
+// IdTokenClaims are the OpenID Connect claims describing the authenticated
+// user to the client, the audience.
+type IdTokenClaims struct {
+	AuthTime            int64  `json:"auth_time"`
+	Nonce               string `json:"nonce,omitempty"`
+	PreferredUsername   string `json:"preferred_username,omitempty"`
+	PhoneNumber         string `json:"phone_number,omitempty"`
+	PhoneNumberVerified bool   `json:"phone_number_verified"`
 	jwt.StandardClaims
 }
 
-func (c AccessTokenClaims) IsUserRole() bool {
-	return c.Role == "user"
-}
-
-func (c AccessTokenClaims) IsValidCustomerId(customerId string) bool {
-	return c.CustomerId == customerId
-}
-
-func (c AccessTokenClaims) IsValidAccountId(accountId string) bool {
-	if accountId != "" {
-		accountFound := false
-		for _, a := range c.Accounts {
-			if a == accountId {
-				accountFound = true
-				break
-			}
-		}
-		return accountFound
-	}
-	return true
-}
-
-func (c AccessTokenClaims) IsRequestVerifiedWithTokenClaims(urlParams map[string]string) bool {
-	if c.CustomerId != urlParams["customer_id"] {
-		return false
-	}
-
-	if !c.IsValidAccountId(urlParams["account_id"]) {
-		return false
-	}
-	return true
+// MfaChallengeClaims are carried by the short lived token a login returns
+// when a second factor is required. It proves the password was checked and
+// carries what the login needs to complete.
+type MfaChallengeClaims struct {
+	TokenType string `json:"token_type"`
+	Username  string `json:"un"`
+	ClientId  string `json:"client_id,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	jwt.StandardClaims
 }
 
-func (c AccessTokenClaims) RefreshTokenClaims() RefreshTokenClaims {
+// newRefreshTokenClaims starts a refresh token for the principal of the
+// access token claims.
+func newRefreshTokenClaims(c authz.AccessTokenClaims) RefreshTokenClaims {
 	return RefreshTokenClaims{
-		TokenType:  "refresh_token",
+		TokenType:  authz.TokenTypeRefresh,
+		UserId:     c.UserId,
 		CustomerId: c.CustomerId,
 		Accounts:   c.Accounts,
 		Username:   c.Username,
+		ClientId:   c.ClientId,
 		Role:       c.Role,
+		Roles:      c.Roles,
+		Scope:      c.Scope,
+		AuthTime:   time.Now().Unix(),
 		StandardClaims: jwt.StandardClaims{
+			// unique per token, a rotated token never repeats its predecessor
+			Id:        NewRandomId(),
+			Issuer:    c.Issuer,
+			Subject:   c.Subject,
+			IssuedAt:  time.Now().Unix(),
 			ExpiresAt: time.Now().Add(REFRESH_TOKEN_DURATION).Unix(),
 		},
 	}
 }
 
-func (c RefreshTokenClaims) AccessTokenClaims() AccessTokenClaims {
-	return AccessTokenClaims{
+// FamilyStart returns when the login the token descends from happened. Tokens
+// issued before it was recorded fall back to their own issue time.
+func (c RefreshTokenClaims) FamilyStart() time.Time {
+	if c.AuthTime > 0 {
+		return time.Unix(c.AuthTime, 0)
+	}
+	return time.Unix(c.IssuedAt, 0)
+}
+
+func (c RefreshTokenClaims) AccessTokenClaims() authz.AccessTokenClaims {
+	return authz.AccessTokenClaims{
+		UserId:     c.UserId,
 		CustomerId: c.CustomerId,
 		Accounts:   c.Accounts,
 		Username:   c.Username,
+		ClientId:   c.ClientId,
 		Role:       c.Role,
+		Roles:      c.Roles,
+		Scope:      c.Scope,
 		StandardClaims: jwt.StandardClaims{
+			Issuer:    c.Issuer,
+			Subject:   c.Subject,
 			ExpiresAt: time.Now().Add(ACCESS_TOKEN_DURATION).Unix(),
 		},
 	}
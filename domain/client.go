@@ -0,0 +1,177 @@
+package domain
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+/*
+Client is an OAuth client, e.g. a resource server introspecting tokens, an app
+logging users in through the authorization endpoint or a backend job calling
+protected routes as itself. Public clients, like mobile apps, have no secret.
+Clients are kept in the clients table:
+
+	client_id varchar(64) primary key, client_secret_hash varchar(255) null,
+	grant_types varchar(255), scopes varchar(255), redirect_uris text,
+	role varchar(20) null, access_token_ttl int null, refresh_token_ttl int null
+
+grant_types, scopes and redirect_uris are space separated lists and the token
+lifetimes are in seconds, null meaning the server defaults. Secrets are stored
+as argon2id hashes, see HashClientSecret.
+*/
+type Client struct {
+	ClientId        string
+	SecretHash      string
+	GrantTypes      []string
+	Scopes          []string
+	RedirectUris    []string
+	Role            string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+func (c Client) IsPublic() bool {
+	return c.SecretHash == ""
+}
+
+// VerifySecret checks the secret of a confidential client.
+func (c Client) VerifySecret(secret string) bool {
+	if c.IsPublic() {
+		return false
+	}
+	ok, _ := NewArgon2idHasher().Verify(secret, c.SecretHash)
+	return ok
+}
+
+// IsValidRedirectUri only accepts URIs registered for the client, compared
+// exactly.
+func (c Client) IsValidRedirectUri(redirectUri string) bool {
+	return contains(c.RedirectUris, redirectUri)
+}
+
+func (c Client) AllowsGrant(grantType string) bool {
+	return contains(c.GrantTypes, grantType)
+}
+
+// AllowsScope accepts a space separated scope when all its scopes are
+// registered for the client.
+func (c Client) AllowsScope(scope string) bool {
+	for _, s := range strings.Fields(scope) {
+		if !contains(c.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Client) AccessTokenDuration() time.Duration {
+	if c.AccessTokenTTL > 0 {
+		return c.AccessTokenTTL
+	}
+	return ACCESS_TOKEN_DURATION
+}
+
+func (c Client) RefreshTokenDuration() time.Duration {
+	if c.RefreshTokenTTL > 0 {
+		return c.RefreshTokenTTL
+	}
+	return REFRESH_TOKEN_DURATION
+}
+
+// ClientSubjectPrefix starts the subject of the tokens of clients, so a client
+// id can never be mistaken for a user.
+const ClientSubjectPrefix = "client:"
+
+// ClaimsForAccessToken builds the claims of a client acting as itself in the
+// client credentials grant. Clients are no users, the token carries no
+// username and its subject is "client:<client_id>".
+func (c Client) ClaimsForAccessToken(scope string) authz.AccessTokenClaims {
+	role := c.Role
+	if role == "" {
+		role = authz.ClientRole
+	}
+	return authz.AccessTokenClaims{
+		ClientId: c.ClientId,
+		Role:     role,
+		Scope:    scope,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   ClientSubjectPrefix + c.ClientId,
+			ExpiresAt: time.Now().Add(c.AccessTokenDuration()).Unix(),
+		},
+	}
+}
+
+// HashClientSecret returns the form client secrets are stored in, a salted
+// argon2id hash like passwords.
+func HashClientSecret(secret string) (string, error) {
+	return NewArgon2idHasher().Hash(secret)
+}
+
+type ClientRepository interface {
+	FindClient(clientId string) (*Client, *errs.AppError)
+}
+
+type ClientRepositoryDb struct {
+	client *sqlx.DB
+}
+
+type clientRow struct {
+	ClientId        string         `db:"client_id"`
+	SecretHash      sql.NullString `db:"client_secret_hash"`
+	GrantTypes      string         `db:"grant_types"`
+	Scopes          string         `db:"scopes"`
+	RedirectUris    string         `db:"redirect_uris"`
+	Role            sql.NullString `db:"role"`
+	AccessTokenTTL  sql.NullInt64  `db:"access_token_ttl"`
+	RefreshTokenTTL sql.NullInt64  `db:"refresh_token_ttl"`
+}
+
+func (d ClientRepositoryDb) FindClient(clientId string) (*Client, *errs.AppError) {
+	var row clientRow
+	sqlSelect := `select client_id, client_secret_hash, grant_types, scopes, redirect_uris, role, access_token_ttl,
+		refresh_token_ttl from clients where client_id = ?`
+	if err := d.client.Get(&row, sqlSelect, clientId); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errs.NewAuthenticationError("unknown client")
+		}
+		logger.Error("Error while loading client: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	return &Client{
+		ClientId:        row.ClientId,
+		SecretHash:      row.SecretHash.String,
+		GrantTypes:      strings.Fields(row.GrantTypes),
+		Scopes:          strings.Fields(row.Scopes),
+		RedirectUris:    strings.Fields(row.RedirectUris),
+		Role:            row.Role.String,
+		AccessTokenTTL:  time.Duration(row.AccessTokenTTL.Int64) * time.Second,
+		RefreshTokenTTL: time.Duration(row.RefreshTokenTTL.Int64) * time.Second,
+	}, nil
+}
+
+func NewClientRepository(client *sqlx.DB) ClientRepositoryDb {
+	return ClientRepositoryDb{client}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
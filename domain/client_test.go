@@ -0,0 +1,10 @@
+package domain
+
+import "testing"
+
+func TestClientSubject(t *testing.T) {
+	claims := Client{ClientId: "42"}.ClaimsForAccessToken("")
+	if claims.Subject != "client:42" || claims.Username != "" {
+		t.Errorf("Subject, Username = %q, %q, want %q, no username", claims.Subject, claims.Username, "client:42")
+	}
+}
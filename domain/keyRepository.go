@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type KeyRepository interface {
+	FindSigningKeys() ([]SigningKey, *errs.AppError)
+	SaveSigningKey(key SigningKey) *errs.AppError
+	RotateSigningKey(activeKid string, next SigningKey, maxRetired int) *errs.AppError
+}
+
+// KeyRepositoryDb stores the private keys encrypted with the SecretCipher.
+type KeyRepositoryDb struct {
+	client *sqlx.DB
+	cipher SecretCipher
+}
+
+func (d KeyRepositoryDb) FindSigningKeys() ([]SigningKey, *errs.AppError) {
+	keys := make([]SigningKey, 0)
+	sqlSelect := "select kid, alg, private_key, status, created_on from signing_keys order by created_on desc"
+	if err := d.client.Select(&keys, sqlSelect); err != nil {
+		logger.Error("Error while loading signing keys: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	for i := range keys {
+		privateKey, err := d.cipher.Decrypt(keys[i].PrivateKey)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Error while decrypting signing key %s: %s", keys[i].Kid, err.Error()))
+			return nil, errs.NewUnexpectedError("cannot decrypt signing keys")
+		}
+		keys[i].PrivateKey = privateKey
+	}
+	return keys, nil
+}
+
+func (d KeyRepositoryDb) SaveSigningKey(key SigningKey) *errs.AppError {
+	privateKey, appErr := d.encrypt(key)
+	if appErr != nil {
+		return appErr
+	}
+	sqlInsert := "insert into signing_keys (kid, alg, private_key, status, created_on) values (?, ?, ?, ?, ?)"
+	if _, err := d.client.Exec(sqlInsert, key.Kid, key.Alg, privateKey, key.Status, key.CreatedOn); err != nil {
+		logger.Error("Error while saving signing key: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+// SIGNING_KEY_RETENTION is how long a retired key still verifies tokens, the
+// lifetime of the longest lived tokens it signed.
+const SIGNING_KEY_RETENTION = REFRESH_TOKEN_DURATION
+
+/*
+RotateSigningKey retires the active key and stores the next one as active.
+Retired keys are kept for SIGNING_KEY_RETENTION, older ones are deleted
+beyond the newest maxRetired, which must not be negative. A conflict error is
+returned when activeKid is no longer the active key, i.e. another instance
+rotated first.
+*/
+func (d KeyRepositoryDb) RotateSigningKey(activeKid string, next SigningKey, maxRetired int) *errs.AppError {
+	privateKey, appErr := d.encrypt(next)
+	if appErr != nil {
+		return appErr
+	}
+	tx, err := d.client.Beginx()
+	if err != nil {
+		logger.Error("Error while starting key rotation: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	defer tx.Rollback()
+
+	sqlRetire := "update signing_keys set status = ?, retired_on = now() where kid = ? and status = ?"
+	result, err := tx.Exec(sqlRetire, SigningKeyRetired, activeKid, SigningKeyActive)
+	if err != nil {
+		logger.Error("Error while retiring signing key: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errs.NewConflictError("signing key " + activeKid + " is no longer active")
+	}
+
+	sqlInsert := "insert into signing_keys (kid, alg, private_key, status, created_on) values (?, ?, ?, ?, ?)"
+	if _, err = tx.Exec(sqlInsert, next.Kid, next.Alg, privateKey, SigningKeyActive, next.CreatedOn); err != nil {
+		logger.Error("Error while saving signing key: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+
+	var retired []string
+	sqlSelect := "select kid from signing_keys where status = ? and retired_on < ? order by retired_on desc"
+	if err = tx.Select(&retired, sqlSelect, SigningKeyRetired, time.Now().Add(-SIGNING_KEY_RETENTION)); err != nil {
+		logger.Error("Error while loading retired signing keys: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	if len(retired) > maxRetired {
+		query, args, _ := sqlx.In("delete from signing_keys where kid in (?)", retired[maxRetired:])
+		if _, err = tx.Exec(query, args...); err != nil {
+			logger.Error("Error while pruning retired signing keys: " + err.Error())
+			return errs.NewUnexpectedError("unexpected database error")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Error("Error while committing key rotation: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+func (d KeyRepositoryDb) encrypt(key SigningKey) (string, *errs.AppError) {
+	privateKey, err := d.cipher.Encrypt(key.PrivateKey)
+	if err != nil {
+		logger.Error("Error while encrypting signing key: " + err.Error())
+		return "", errs.NewUnexpectedError("cannot encrypt signing key")
+	}
+	return privateKey, nil
+}
+
+func NewKeyRepository(client *sqlx.DB, cipher SecretCipher) KeyRepositoryDb {
+	return KeyRepositoryDb{client, cipher}
+}
@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// KeyRing holds the active signing key and the retired keys that are still
+// accepted for verification, so tokens signed before a rotation stay valid.
+type KeyRing struct {
+	mu        sync.RWMutex
+	active    Signer
+	createdOn time.Time
+	retired   []Signer
+}
+
+// Signer returns the key new tokens are signed with.
+func (k *KeyRing) Signer() Signer {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// ActiveSince returns the time the active key was created.
+func (k *KeyRing) ActiveSince() time.Time {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.createdOn
+}
+
+// KeyFunc selects the verification key by the token's kid header. Tokens
+// without a kid were issued before key ids existed and are checked against
+// the active key.
+func (k *KeyRing) KeyFunc(token *jwt.Token) (interface{}, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	kid, ok := token.Header["kid"]
+	if !ok {
+		return k.active.KeyFunc(token)
+	}
+	for _, s := range k.signers() {
+		if s.Kid() == kid {
+			return s.KeyFunc(token)
+		}
+	}
+	return nil, fmt.Errorf("unknown key id: %v", kid)
+}
+
+func (k *KeyRing) Jwks() authz.JSONWebKeySet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := make([]authz.JWK, 0)
+	for _, s := range k.signers() {
+		if jwk, ok := s.JWK(); ok {
+			keys = append(keys, jwk)
+		}
+	}
+	return authz.JSONWebKeySet{Keys: keys}
+}
+
+// Load replaces the keys of the ring with the persisted ones. Exactly one of
+// them must be active.
+func (k *KeyRing) Load(keys []SigningKey) error {
+	var active Signer
+	var createdOn time.Time
+	retired := make([]Signer, 0, len(keys))
+	for _, key := range keys {
+		s, err := key.Signer()
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", key.Kid, err)
+		}
+		if key.Status != SigningKeyActive {
+			retired = append(retired, s)
+		} else if active != nil {
+			return fmt.Errorf("more than one active signing key: %s and %s", active.Kid(), key.Kid)
+		} else {
+			active, createdOn = s, key.CreatedOn
+		}
+	}
+	if active == nil {
+		return fmt.Errorf("no active signing key")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.active, k.createdOn, k.retired = active, createdOn, retired
+	return nil
+}
+
+func (k *KeyRing) signers() []Signer {
+	return append([]Signer{k.active}, k.retired...)
+}
+
+func NewKeyRing(active Signer) *KeyRing {
+	return &KeyRing{active: active, createdOn: time.Now()}
+}
@@ -2,47 +2,131 @@ package domain
 
 import (
 	"database/sql"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+
 	"github.com/dgrijalva/jwt-go"
 )
 
+/*
+Login is a row of the users table. The password column holds the encoded
+password hash, widen it when it is still shorter than varchar(255).
+sanyukt_user_id links the login to the sanyukt_users row of its verified
+mobile number, the two tables have their own user ids:
+
+	alter table users modify password varchar(255) not null
+	alter table users add sanyukt_user_id bigint null unique
+*/
 type Login struct {
-	UserId     int64          `db:"user_id"`
-	Username   string         `db:"username"`
-	CustomerId sql.NullString `db:"customer_id"`
-	Accounts   sql.NullString `db:"account_numbers"`
-	Role       string         `db:"role"`
+	UserId         int64          `db:"user_id"`
+	SanyuktUserId  sql.NullInt64  `db:"sanyukt_user_id"`
+	Username       string         `db:"username"`
+	PasswordHash   string         `db:"password"`
+	CustomerId     sql.NullString `db:"customer_id"`
+	Accounts       sql.NullString `db:"account_numbers"`
+	Role           string         `db:"role"`
+	ExtraRoles     sql.NullString `db:"roles"`
+	Mobile         sql.NullString `db:"user_mobile"`
+	MobileVerified sql.NullBool   `db:"otp_verified"`
+}
+
+// Registration is a new username/password user, see AuthRepository.Register.
+// Registrations with a mobile number are pending until the number is
+// verified, see AuthRepository.CompleteRegistration.
+type Registration struct {
+	Username     string
+	PasswordHash string
+	Mobile       sql.NullString
+	Role         string
 }
 
-func (l Login) ClaimsForAccessToken() AccessTokenClaims {
-	if l.Accounts.Valid && l.CustomerId.Valid {
+func (l Login) ClaimsForAccessToken() authz.AccessTokenClaims {
+	if l.CustomerId.Valid {
 		return l.claimsForUser()
 	} else {
 		return l.claimsForAdmin()
 	}
 }
 
-func (l Login) claimsForUser() AccessTokenClaims {
-	accounts := strings.Split(l.Accounts.String, ",")
-	return AccessTokenClaims{
+func (l Login) claimsForUser() authz.AccessTokenClaims {
+	accounts := []string{}
+	if l.Accounts.Valid && l.Accounts.String != "" {
+		accounts = strings.Split(l.Accounts.String, ",")
+	}
+	return authz.AccessTokenClaims{
+		UserId:     l.userId(),
 		CustomerId: l.CustomerId.String,
 		Accounts:   accounts,
 		Username:   l.Username,
 		Role:       l.Role,
+		Roles:      l.rolesClaim(),
 		StandardClaims: jwt.StandardClaims{
+			Subject:   l.TokenOwner(),
 			ExpiresAt: time.Now().Add(ACCESS_TOKEN_DURATION).Unix(),
 		},
 	}
 }
 
-func (l Login) claimsForAdmin() AccessTokenClaims {
-	return AccessTokenClaims{
+func (l Login) claimsForAdmin() authz.AccessTokenClaims {
+	return authz.AccessTokenClaims{
+		UserId:   l.userId(),
 		Username: l.Username,
 		Role:     l.Role,
+		Roles:    l.rolesClaim(),
 		StandardClaims: jwt.StandardClaims{
+			Subject:   l.TokenOwner(),
 			ExpiresAt: time.Now().Add(ACCESS_TOKEN_DURATION).Unix(),
 		},
 	}
 }
+
+// Roles returns the primary role of the user followed by the roles granted in
+// the user_roles table:
+//
+//	user_id int, role varchar(32), primary key (user_id, role)
+func (l Login) Roles() []string {
+	roles := []string{l.Role}
+	if l.ExtraRoles.Valid && l.ExtraRoles.String != "" {
+		for _, r := range strings.Split(l.ExtraRoles.String, ",") {
+			if r != l.Role {
+				roles = append(roles, r)
+			}
+		}
+	}
+	return roles
+}
+
+func (l Login) HasRole(role string) bool {
+	for _, r := range l.Roles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// rolesClaim is only set for users holding more than their primary role.
+func (l Login) rolesClaim() []string {
+	if roles := l.Roles(); len(roles) > 1 {
+		return roles
+	}
+	return nil
+}
+
+func (l Login) userId() string {
+	return strconv.FormatInt(l.UserId, 10)
+}
+
+func (l Login) ClaimsForIdToken() IdTokenClaims {
+	return IdTokenClaims{
+		PreferredUsername:   l.Username,
+		PhoneNumber:         l.Mobile.String,
+		PhoneNumberVerified: l.Mobile.Valid && l.MobileVerified.Bool,
+		StandardClaims: jwt.StandardClaims{
+			Subject: l.TokenOwner(),
+		},
+	}
+}
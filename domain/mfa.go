@@ -0,0 +1,199 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	MFA_CHALLENGE_DURATION = 5 * time.Minute
+	RECOVERY_CODE_COUNT    = 10
+	LoginMethodTotp        = "totp"
+)
+
+/*
+TotpEnrollment is the TOTP second factor of a user, kept in the mfa_totp table:
+
+	user_id int primary key, secret varchar(255), confirmed bool not null,
+	last_used_step bigint not null default 0, created_on datetime default now()
+
+The secret is stored encrypted with the SecretCipher. An enrollment only
+protects logins once the user confirmed it with a first code.
+*/
+type TotpEnrollment struct {
+	UserId       int64  `db:"user_id"`
+	Secret       string `db:"secret"`
+	Confirmed    bool   `db:"confirmed"`
+	LastUsedStep int64  `db:"last_used_step"`
+}
+
+// NewRecoveryCodes returns one time codes like "k3v9q-2xw7m" the user can log
+// in with when the authenticator is lost.
+func NewRecoveryCodes() []string {
+	const alphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+	codes := make([]string, RECOVERY_CODE_COUNT)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+	}
+	return codes
+}
+
+// HashRecoveryCode normalizes the code as typed by the user before hashing,
+// the codes have enough entropy for a plain SHA-256.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+MfaRepository keeps TOTP enrollments and the recovery codes, hashed, in the
+mfa_recovery_codes table:
+
+	user_id int, code_hash char(64), used_on datetime null,
+	primary key (user_id, code_hash)
+*/
+type MfaRepository interface {
+	FindTotp(userId int64) (*TotpEnrollment, *errs.AppError)
+	SaveTotpEnrollment(userId int64, secret string) *errs.AppError
+	ConfirmTotp(userId int64, step int64, recoveryCodes []string) *errs.AppError
+	UseTotpStep(userId int64, step int64) *errs.AppError
+	UseRecoveryCode(userId int64, code string) *errs.AppError
+}
+
+type MfaRepositoryDb struct {
+	client *sqlx.DB
+	cipher SecretCipher
+}
+
+// FindTotp returns a not found error when the user has no enrollment.
+func (d MfaRepositoryDb) FindTotp(userId int64) (*TotpEnrollment, *errs.AppError) {
+	var enrollment TotpEnrollment
+	sqlSelect := "select user_id, secret, confirmed, last_used_step from mfa_totp where user_id = ?"
+	if err := d.client.Get(&enrollment, sqlSelect, userId); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errs.NewNotFoundError("no totp enrollment")
+		}
+		logger.Error("Error while loading totp enrollment: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	secret, err := d.cipher.Decrypt(enrollment.Secret)
+	if err != nil {
+		logger.Error("Error while decrypting totp secret: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected error")
+	}
+	enrollment.Secret = secret
+	return &enrollment, nil
+}
+
+// SaveTotpEnrollment starts a new enrollment, replacing one that was never
+// confirmed. A confirmed enrollment is a conflict.
+func (d MfaRepositoryDb) SaveTotpEnrollment(userId int64, secret string) *errs.AppError {
+	encrypted, err := d.cipher.Encrypt(secret)
+	if err != nil {
+		logger.Error("Error while encrypting totp secret: " + err.Error())
+		return errs.NewUnexpectedError("unexpected error")
+	}
+	sqlUpsert := `insert into mfa_totp (user_id, secret, confirmed, last_used_step) values (?, ?, false, 0)
+		on duplicate key update secret = if(confirmed, secret, values(secret))`
+	if _, err = d.client.Exec(sqlUpsert, userId, encrypted); err != nil {
+		logger.Error("Error while saving totp enrollment: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	var stored string
+	if err = d.client.Get(&stored, "select secret from mfa_totp where user_id = ?", userId); err != nil {
+		logger.Error("Error while saving totp enrollment: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	if stored != encrypted {
+		return errs.NewConflictError("totp already enrolled")
+	}
+	return nil
+}
+
+// ConfirmTotp activates the enrollment and replaces the recovery codes of the
+// user.
+func (d MfaRepositoryDb) ConfirmTotp(userId int64, step int64, recoveryCodes []string) *errs.AppError {
+	tx, err := d.client.Beginx()
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	defer tx.Rollback()
+
+	sqlUpdate := "update mfa_totp set confirmed = true, last_used_step = ? where user_id = ? and confirmed = false"
+	result, err := tx.Exec(sqlUpdate, step, userId)
+	if err != nil {
+		logger.Error("Error while confirming totp enrollment: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errs.NewConflictError("totp already confirmed")
+	}
+	if _, err = tx.Exec("delete from mfa_recovery_codes where user_id = ?", userId); err != nil {
+		logger.Error("Error while replacing recovery codes: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	for _, code := range recoveryCodes {
+		sqlInsert := "insert into mfa_recovery_codes (user_id, code_hash) values (?, ?)"
+		if _, err = tx.Exec(sqlInsert, userId, HashRecoveryCode(code)); err != nil {
+			logger.Error("Error while saving recovery codes: " + err.Error())
+			return errs.NewUnexpectedError("unexpected database error")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+// UseTotpStep records the time step of an accepted code. A conflict means a
+// concurrent login used the same or a later step first.
+func (d MfaRepositoryDb) UseTotpStep(userId int64, step int64) *errs.AppError {
+	sqlUpdate := "update mfa_totp set last_used_step = ? where user_id = ? and last_used_step < ?"
+	result, err := d.client.Exec(sqlUpdate, step, userId, step)
+	if err != nil {
+		logger.Error("Error while using totp code: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errs.NewConflictError("totp code already used")
+	}
+	return nil
+}
+
+// UseRecoveryCode consumes an unused recovery code of the user.
+func (d MfaRepositoryDb) UseRecoveryCode(userId int64, code string) *errs.AppError {
+	sqlUpdate := "update mfa_recovery_codes set used_on = now() where user_id = ? and code_hash = ? and used_on is null"
+	result, err := d.client.Exec(sqlUpdate, userId, HashRecoveryCode(code))
+	if err != nil {
+		logger.Error("Error while using recovery code: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errs.NewAuthenticationError("invalid recovery code")
+	}
+	return nil
+}
+
+func NewMfaRepository(client *sqlx.DB, cipher SecretCipher) MfaRepositoryDb {
+	return MfaRepositoryDb{client, cipher}
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"fmt"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"github.com/jmoiron/sqlx"
+)
+
+/*
+Migration is a one-off change to the data of existing installs, like
+encrypting values that used to be stored in plaintext. Applied migrations
+are recorded in the schema_migrations table:
+
+	id varchar(100) primary key, applied_on datetime not null
+*/
+type Migration struct {
+	Id    string
+	Apply func(tx *sqlx.Tx) error
+}
+
+type MigrationRepository interface {
+	Apply(migrations []Migration) *errs.AppError
+}
+
+type MigrationRepositoryDb struct {
+	client *sqlx.DB
+}
+
+/*
+Apply runs the migrations not applied yet, in order, each in its own
+transaction with the record of it. Instances starting at the same time wait
+on the record, so every migration runs exactly once.
+*/
+func (d MigrationRepositoryDb) Apply(migrations []Migration) *errs.AppError {
+	for _, m := range migrations {
+		if appErr := d.apply(m); appErr != nil {
+			return appErr
+		}
+	}
+	return nil
+}
+
+func (d MigrationRepositoryDb) apply(m Migration) *errs.AppError {
+	tx, err := d.client.Beginx()
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	defer tx.Rollback()
+
+	sqlInsert := "insert into schema_migrations (id, applied_on) values (?, now())"
+	if _, err = tx.Exec(sqlInsert, m.Id); err != nil {
+		if isDuplicateEntry(err) {
+			return nil
+		}
+		logger.Error("Error while recording migration: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	if err = m.Apply(tx); err != nil {
+		logger.Error(fmt.Sprintf("Error while applying migration %s: %s", m.Id, err.Error()))
+		return errs.NewUnexpectedError("cannot apply migration " + m.Id)
+	}
+	if err = tx.Commit(); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	logger.Info("Applied migration " + m.Id)
+	return nil
+}
+
+func NewMigrationRepository(client *sqlx.DB) MigrationRepositoryDb {
+	return MigrationRepositoryDb{client}
+}
@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+)
+
+const (
+	OTP_DURATION     = 5 * time.Minute
+	OTP_MAX_ATTEMPTS = 5
+	OtpErrorExpired  = "otp_expired"
+	OtpErrorInvalid  = "otp_invalid"
+	OtpErrorLocked   = "otp_locked"
+)
+
+// OtpPolicy limits how long an OTP is valid and how many wrong codes may be
+// tried before the code is locked and a new one has to be requested.
+type OtpPolicy struct {
+	TTL         time.Duration
+	MaxAttempts int
+}
+
+func NewOtpPolicy() OtpPolicy {
+	return OtpPolicy{TTL: OTP_DURATION, MaxAttempts: OTP_MAX_ATTEMPTS}
+}
+
+/*
+Otp is the code last issued for a mobile number, a row of the users_otp table:
+
+	user_mobile varchar(15) unique, user_otp char(64), otp_verified bool,
+	user_id int, created_on datetime, updated_on datetime,
+	failed_attempts int not null default 0, consumed_on datetime null
+
+user_otp holds the code hashed by OtpHasher. Issuing a new code resets
+failed_attempts and consumed_on. otp_verified stays set once the mobile number
+has been verified.
+*/
+type Otp struct {
+	UserId         int64        `db:"user_id"`
+	Mobile         string       `db:"user_mobile"`
+	Code           string       `db:"user_otp"`
+	FailedAttempts int          `db:"failed_attempts"`
+	ConsumedOn     sql.NullTime `db:"consumed_on"`
+	AgeSeconds     int64        `db:"age_seconds"`
+}
+
+// NewOtpCode returns a uniformly random six digit code.
+func NewOtpCode() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+func (o Otp) IsLocked(policy OtpPolicy) bool {
+	return o.FailedAttempts >= policy.MaxAttempts
+}
+
+func (o Otp) IsExpired(policy OtpPolicy) bool {
+	return o.ConsumedOn.Valid || time.Duration(o.AgeSeconds)*time.Second > policy.TTL
+}
+
+// Matches checks the code against the stored hash, plaintext codes are hashed
+// by the HashPlaintextOtps migration and never match.
+func (o Otp) Matches(code string, hasher OtpHasher) bool {
+	return subtle.ConstantTimeCompare([]byte(o.Code), []byte(hasher.Hash(o.Mobile, code))) == 1
+}
+
+// OtpHasher hashes OTPs with HMAC-SHA256 keyed with a server side pepper, so
+// the six digit codes can not be brute forced from a copy of the database.
+// The code is bound to the mobile number it was sent to.
+type OtpHasher struct {
+	pepper []byte
+}
+
+func NewOtpHasher(pepper []byte) OtpHasher {
+	return OtpHasher{pepper}
+}
+
+func (h OtpHasher) Hash(mobile string, code string) string {
+	mac := hmac.New(sha256.New, h.pepper)
+	mac.Write([]byte(mobile + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func NewOtpExpiredError() *errs.AppError {
+	return errs.NewCodedError(http.StatusUnauthorized, OtpErrorExpired, "otp expired, request a new one")
+}
+
+func NewOtpInvalidError() *errs.AppError {
+	return errs.NewCodedError(http.StatusUnauthorized, OtpErrorInvalid, "invalid otp")
+}
+
+func NewOtpLockedError() *errs.AppError {
+	return errs.NewCodedError(http.StatusTooManyRequests, OtpErrorLocked, "too many wrong otps, request a new one")
+}
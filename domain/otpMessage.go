@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const DefaultOtpLocale = "en"
+
+/*
+defaultOtpTemplates are the built in message templates per locale. A template
+renders the message body and defines "subject", used as the email subject.
+Templates are executed with OtpMessageData.
+*/
+var defaultOtpTemplates = map[string]string{
+	"en": `{{define "subject"}}Your verification code{{end}}` +
+		`{{.Code}} is your verification code. It expires in {{.Minutes}} minutes. Do not share it with anyone.`,
+	"hi": `{{define "subject"}}आपका सत्यापन कोड{{end}}` +
+		`{{.Code}} आपका सत्यापन कोड है। यह {{.Minutes}} मिनट में समाप्त हो जाएगा। इसे किसी के साथ साझा न करें।`,
+}
+
+type OtpMessageData struct {
+	Code    string
+	Minutes int
+}
+
+type OtpMessage struct {
+	Subject string
+	Body    string
+}
+
+// OtpTemplates renders the localized OTP messages.
+type OtpTemplates struct {
+	templates map[string]*template.Template
+}
+
+/*
+NewOtpTemplates parses the built in templates and, when dir is not empty, the
+<locale>.tmpl files in dir, e.g. "mr.tmpl", which add locales or replace the
+built in templates.
+*/
+func NewOtpTemplates(dir string) (OtpTemplates, error) {
+	sources := make(map[string]string)
+	for locale, text := range defaultOtpTemplates {
+		sources[locale] = text
+	}
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return OtpTemplates{}, err
+		}
+		for _, file := range files {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return OtpTemplates{}, err
+			}
+			sources[strings.ToLower(strings.TrimSuffix(filepath.Base(file), ".tmpl"))] = string(b)
+		}
+	}
+
+	t := OtpTemplates{templates: make(map[string]*template.Template)}
+	for locale, text := range sources {
+		tmpl, err := template.New(locale).Parse(text)
+		if err != nil {
+			return OtpTemplates{}, fmt.Errorf("otp template %s: %w", locale, err)
+		}
+		t.templates[locale] = tmpl
+	}
+	return t, nil
+}
+
+// Render builds the message for the locale, e.g. "hi-IN" or an
+// Accept-Language header value, falling back to the language alone and then
+// to English.
+func (t OtpTemplates) Render(locale string, code string, ttl time.Duration) (OtpMessage, error) {
+	tmpl := t.lookup(locale)
+	data := OtpMessageData{Code: code, Minutes: int(ttl.Minutes())}
+
+	var subject, body bytes.Buffer
+	if tmpl.Lookup("subject") != nil {
+		if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+			return OtpMessage{}, err
+		}
+	}
+	if err := tmpl.Execute(&body, data); err != nil {
+		return OtpMessage{}, err
+	}
+	return OtpMessage{Subject: strings.TrimSpace(subject.String()), Body: strings.TrimSpace(body.String())}, nil
+}
+
+func (t OtpTemplates) lookup(locale string) *template.Template {
+	// first entry of an Accept-Language header, without its quality
+	locale = strings.TrimSpace(strings.SplitN(strings.SplitN(locale, ",", 2)[0], ";", 2)[0])
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if tmpl, ok := t.templates[locale]; ok {
+		return tmpl
+	}
+	if tmpl, ok := t.templates[strings.SplitN(locale, "-", 2)[0]]; ok {
+		return tmpl
+	}
+	return t.templates[DefaultOtpLocale]
+}
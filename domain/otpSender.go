@@ -0,0 +1,218 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	OtpChannelSms   = "sms"
+	OtpChannelEmail = "email"
+	OtpChannelFile  = "file"
+	OtpChannelLog   = "log"
+)
+
+// OtpSender delivers OTP messages over one channel.
+type OtpSender interface {
+	Channel() string
+	// Recipient returns the address of the user on the channel, empty when
+	// the user has none.
+	Recipient(user Users) string
+	Send(recipient string, message OtpMessage) error
+}
+
+/*
+SmsOtpSender posts messages to a generic HTTP SMS gateway as JSON:
+
+	{"to": "+919876543210", "from": "SANYKT", "message": "..."}
+
+authenticated with a bearer API key. Any 2xx status means the message was
+accepted.
+*/
+type SmsOtpSender struct {
+	gatewayUrl string
+	apiKey     string
+	from       string
+	client     *http.Client
+}
+
+func NewSmsOtpSender(gatewayUrl string, apiKey string, from string) SmsOtpSender {
+	return SmsOtpSender{gatewayUrl, apiKey, from, &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s SmsOtpSender) Channel() string {
+	return OtpChannelSms
+}
+
+func (s SmsOtpSender) Recipient(user Users) string {
+	return user.Mobile
+}
+
+func (s SmsOtpSender) Send(recipient string, message OtpMessage) error {
+	payload, err := json.Marshal(map[string]string{"to": recipient, "from": s.from, "message": message.Body})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, s.gatewayUrl, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		request.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("sms gateway responded with status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// EmailOtpSender sends messages as plain text mails through an SMTP server,
+// using PLAIN authentication when a username is set.
+type EmailOtpSender struct {
+	addr     string
+	username string
+	password string
+	from     string
+}
+
+func NewEmailOtpSender(addr string, username string, password string, from string) EmailOtpSender {
+	return EmailOtpSender{addr, username, password, from}
+}
+
+func (s EmailOtpSender) Channel() string {
+	return OtpChannelEmail
+}
+
+func (s EmailOtpSender) Recipient(user Users) string {
+	return user.Email.String
+}
+
+func (s EmailOtpSender) Send(recipient string, message OtpMessage) error {
+	if strings.ContainsAny(recipient, "\r\n") {
+		return errors.New("invalid email address")
+	}
+	var auth smtp.Auth
+	if s.username != "" {
+		host, _, err := net.SplitHostPort(s.addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.username, s.password, host)
+	}
+	mail := "From: " + s.from + "\r\n" +
+		"To: " + recipient + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + message.Body + "\r\n"
+	return smtp.SendMail(s.addr, auth, s.from, []string{recipient}, []byte(mail))
+}
+
+/*
+DevOtpSender is meant for development only: it appends the messages, codes
+included, to a file or, without a path, writes them to the log. Messages are
+addressed to the mobile number of the user.
+*/
+type DevOtpSender struct {
+	path string
+	mu   *sync.Mutex
+}
+
+func NewDevOtpSender(path string) DevOtpSender {
+	return DevOtpSender{path, &sync.Mutex{}}
+}
+
+func (s DevOtpSender) Channel() string {
+	if s.path == "" {
+		return OtpChannelLog
+	}
+	return OtpChannelFile
+}
+
+func (s DevOtpSender) Recipient(user Users) string {
+	return user.Mobile
+}
+
+func (s DevOtpSender) Send(recipient string, message OtpMessage) error {
+	if s.path == "" {
+		logger.Info("OTP message", zap.String("to", recipient), zap.String("message", message.Body))
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339), recipient, message.Body)
+	return err
+}
+
+// OtpNotifier renders the OTP message in the user's language and sends it
+// over the configured channel.
+type OtpNotifier struct {
+	sender    OtpSender
+	templates OtpTemplates
+	ttl       time.Duration
+}
+
+func NewOtpNotifier(sender OtpSender, templates OtpTemplates, ttl time.Duration) OtpNotifier {
+	return OtpNotifier{sender, templates, ttl}
+}
+
+func (n OtpNotifier) TTL() time.Duration {
+	return n.ttl
+}
+
+// Notify sends the code to the user and returns the channel and the masked
+// recipient it was sent to.
+func (n OtpNotifier) Notify(user Users, code string, locale string) (string, string, error) {
+	recipient := n.sender.Recipient(user)
+	if recipient == "" {
+		return "", "", fmt.Errorf("user %d has no %s recipient", user.Id, n.sender.Channel())
+	}
+	message, err := n.templates.Render(locale, code, n.ttl)
+	if err != nil {
+		return "", "", err
+	}
+	if err = n.sender.Send(recipient, message); err != nil {
+		return "", "", err
+	}
+	return n.sender.Channel(), MaskRecipient(recipient), nil
+}
+
+// MaskRecipient hides most of a mobile number or the local part of an email
+// address, e.g. "******3210" or "h***@example.com".
+func MaskRecipient(recipient string) string {
+	if at := strings.LastIndex(recipient, "@"); at >= 0 {
+		if at == 0 {
+			return "***" + recipient[at:]
+		}
+		return recipient[:1] + "***" + recipient[at:]
+	}
+	if len(recipient) <= 4 {
+		return strings.Repeat("*", len(recipient))
+	}
+	return strings.Repeat("*", len(recipient)-4) + recipient[len(recipient)-4:]
+}
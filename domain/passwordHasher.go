@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/*
+PasswordHasher hashes passwords for storage and verifies passwords against
+stored hashes. Verify reports whether the stored hash should be replaced with
+a fresh one, because it was made with another algorithm or weaker parameters
+than the hasher uses now.
+*/
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password string, encodedHash string) (ok bool, needsRehash bool)
+}
+
+// Argon2idHasher produces PHC formatted hashes:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func NewArgon2idHasher() Argon2idHasher {
+	return Argon2idHasher{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Verify(password string, encodedHash string) (bool, bool) {
+	params, salt, key, err := decodeArgon2idHash(encodedHash)
+	if err != nil {
+		return false, false
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false
+	}
+	weaker := params.Memory < h.Memory || params.Iterations < h.Iterations || uint32(len(key)) < h.KeyLength
+	return true, weaker
+}
+
+func decodeArgon2idHash(encodedHash string) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("not an argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher() BcryptHasher {
+	return BcryptHasher{Cost: 12}
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h BcryptHasher) Verify(password string, encodedHash string) (bool, bool) {
+	if bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	return true, err != nil || cost < h.Cost
+}
+
+/*
+MigratingPasswordHasher hashes with the preferred hasher and verifies hashes
+of every supported algorithm. Anything not made by the preferred hasher is
+reported as needing a rehash, so stored passwords migrate as users log in.
+Legacy plaintext passwords only verify when allowPlaintext is set, and every
+use of one is logged.
+*/
+type MigratingPasswordHasher struct {
+	algorithm      string
+	preferred      PasswordHasher
+	argon2id       Argon2idHasher
+	bcrypt         BcryptHasher
+	allowPlaintext bool
+}
+
+func (h MigratingPasswordHasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+func (h MigratingPasswordHasher) Verify(password string, encodedHash string) (bool, bool) {
+	var hasher PasswordHasher
+	var algorithm string
+	switch {
+	case strings.HasPrefix(encodedHash, "$argon2id$"):
+		hasher, algorithm = h.argon2id, "argon2id"
+	case strings.HasPrefix(encodedHash, "$2a$"), strings.HasPrefix(encodedHash, "$2b$"), strings.HasPrefix(encodedHash, "$2y$"):
+		hasher, algorithm = h.bcrypt, "bcrypt"
+	default:
+		return h.verifyPlaintext(password, encodedHash)
+	}
+	ok, needsRehash := hasher.Verify(password, encodedHash)
+	return ok, ok && (needsRehash || algorithm != h.algorithm)
+}
+
+func (h MigratingPasswordHasher) verifyPlaintext(password string, storedPassword string) (bool, bool) {
+	if !h.allowPlaintext || storedPassword == "" {
+		return false, false
+	}
+	ok := subtle.ConstantTimeCompare([]byte(password), []byte(storedPassword)) == 1
+	if ok {
+		logger.Warn("Security event: login with a plaintext stored password, rehashing it",
+			zap.String("event", "plaintext_password_used"))
+	}
+	return ok, ok
+}
+
+// NewPasswordHasher returns the hasher for the "argon2id" (default) or
+// "bcrypt" algorithm, able to verify the hashes of all of them and, with
+// allowPlaintext, the plaintext passwords of installs not migrated yet.
+func NewPasswordHasher(algorithm string, allowPlaintext bool) (MigratingPasswordHasher, error) {
+	h := MigratingPasswordHasher{argon2id: NewArgon2idHasher(), bcrypt: NewBcryptHasher(), allowPlaintext: allowPlaintext}
+	switch algorithm {
+	case "", "argon2id":
+		h.algorithm, h.preferred = "argon2id", h.argon2id
+	case "bcrypt":
+		h.algorithm, h.preferred = "bcrypt", h.bcrypt
+	default:
+		return h, fmt.Errorf("unsupported password hash algorithm %s", algorithm)
+	}
+	return h, nil
+}
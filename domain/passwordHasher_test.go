@@ -0,0 +1,82 @@
+package domain
+
+import "testing"
+
+func mustHash(t *testing.T, h PasswordHasher, password string) string {
+	t.Helper()
+	hash, err := h.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestMigratingPasswordHasher(t *testing.T) {
+	argon2id := NewArgon2idHasher()
+	weakArgon2id := Argon2idHasher{Memory: 16 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	bcrypt := NewBcryptHasher()
+	weakBcrypt := BcryptHasher{Cost: 4}
+
+	argon2idHash := mustHash(t, argon2id, "secret")
+	weakArgon2idHash := mustHash(t, weakArgon2id, "secret")
+	bcryptHash := mustHash(t, bcrypt, "secret")
+	weakBcryptHash := mustHash(t, weakBcrypt, "secret")
+
+	tests := []struct {
+		name            string
+		algorithm       string
+		allowPlaintext  bool
+		password        string
+		storedHash      string
+		wantOk          bool
+		wantNeedsRehash bool
+	}{
+		{"argon2id", "argon2id", false, "secret", argon2idHash, true, false},
+		{"argon2id wrong password", "argon2id", false, "other", argon2idHash, false, false},
+		{"argon2id weaker parameters", "argon2id", false, "secret", weakArgon2idHash, true, true},
+		{"bcrypt to argon2id", "argon2id", false, "secret", weakBcryptHash, true, true},
+		{"bcrypt to argon2id wrong password", "argon2id", false, "other", weakBcryptHash, false, false},
+		{"default algorithm", "", false, "secret", argon2idHash, true, false},
+		{"bcrypt", "bcrypt", false, "secret", bcryptHash, true, false},
+		{"bcrypt lower cost", "bcrypt", false, "secret", weakBcryptHash, true, true},
+		{"argon2id to bcrypt", "bcrypt", false, "secret", argon2idHash, true, true},
+		{"plaintext not allowed", "argon2id", false, "secret", "secret", false, false},
+		{"plaintext allowed", "argon2id", true, "secret", "secret", true, true},
+		{"plaintext wrong password", "argon2id", true, "other", "secret", false, false},
+		{"plaintext empty", "argon2id", true, "", "", false, false},
+		{"malformed argon2id", "argon2id", true, "secret", "$argon2id$v=19$m=65536", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewPasswordHasher(tt.algorithm, tt.allowPlaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ok, needsRehash := h.Verify(tt.password, tt.storedHash)
+			if ok != tt.wantOk || needsRehash != tt.wantNeedsRehash {
+				t.Errorf("Verify = %v, %v, want %v, %v", ok, needsRehash, tt.wantOk, tt.wantNeedsRehash)
+			}
+		})
+	}
+}
+
+func TestMigratingPasswordHasherRehash(t *testing.T) {
+	for _, algorithm := range []string{"argon2id", "bcrypt"} {
+		t.Run(algorithm, func(t *testing.T) {
+			h, err := NewPasswordHasher(algorithm, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash := mustHash(t, h, "secret")
+			if ok, needsRehash := h.Verify("secret", hash); !ok || needsRehash {
+				t.Errorf("Verify of a fresh hash = %v, %v, want true, false", ok, needsRehash)
+			}
+		})
+	}
+}
+
+func TestNewPasswordHasherUnknownAlgorithm(t *testing.T) {
+	if _, err := NewPasswordHasher("md5", false); err == nil {
+		t.Error("NewPasswordHasher(md5) succeeded, want an error")
+	}
+}
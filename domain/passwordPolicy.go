@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+)
+
+// PasswordPolicy is checked when users choose a password. The maximum length
+// keeps passwords within the 72 bytes bcrypt uses.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+}
+
+func NewPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 10, MaxLength: 72}
+}
+
+// Check requires a letter and a digit, and rejects passwords containing the
+// username.
+func (p PasswordPolicy) Check(username string, password string) *errs.AppError {
+	if len(password) < p.MinLength || len(password) > p.MaxLength {
+		return errs.NewValidationError(fmt.Sprintf("password must be between %d and %d characters", p.MinLength, p.MaxLength))
+	}
+	var letter, digit bool
+	for _, r := range password {
+		letter = letter || unicode.IsLetter(r)
+		digit = digit || unicode.IsDigit(r)
+	}
+	if !letter || !digit {
+		return errs.NewValidationError("password must contain a letter and a digit")
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return errs.NewValidationError("password must not contain the username")
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Names of the rate limits, a limit is configured by setting RATE_LIMIT_ and
+// the upper cased name, e.g. RATE_LIMIT_LOGIN_USERNAME="10/15m".
+const (
+	RateLimitLoginUsername = "login_username"
+	RateLimitLoginIp       = "login_ip"
+	RateLimitOtpResend     = "otp_resend"
+	RateLimitOtpMobile     = "otp_mobile"
+	RateLimitOtpIp         = "otp_ip"
+)
+
+// RateLimit allows Limit requests per fixed Window.
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// ParseRateLimit parses limits written as "<limit>/<window>", e.g. "5/1h".
+func ParseRateLimit(s string) (RateLimit, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return RateLimit{}, fmt.Errorf("rate limit %q is not <limit>/<window>", s)
+	}
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit < 1 {
+		return RateLimit{}, fmt.Errorf("invalid limit in rate limit %q", s)
+	}
+	window, err := time.ParseDuration(parts[1])
+	if err != nil || window <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid window in rate limit %q", s)
+	}
+	return RateLimit{limit, window}, nil
+}
+
+/*
+DefaultRateLimits protect the login against password guessing and the OTP
+endpoint against flooding a number with messages: an OTP can be resent once a
+minute and five times an hour per mobile number.
+*/
+func DefaultRateLimits() map[string]RateLimit {
+	return map[string]RateLimit{
+		RateLimitLoginUsername: {10, 15 * time.Minute},
+		RateLimitLoginIp:       {100, 15 * time.Minute},
+		RateLimitOtpResend:     {1, time.Minute},
+		RateLimitOtpMobile:     {5, time.Hour},
+		RateLimitOtpIp:         {20, time.Hour},
+	}
+}
+
+// RateLimitStore counts hits per key in fixed windows. Hit returns the hits
+// in the current window, this one included, and when the window ends.
+type RateLimitStore interface {
+	Hit(key string, window time.Duration) (int, time.Duration, *errs.AppError)
+	DeleteExpired() *errs.AppError
+}
+
+type RateLimiter struct {
+	store  RateLimitStore
+	limits map[string]RateLimit
+}
+
+func NewRateLimiter(store RateLimitStore, limits map[string]RateLimit) RateLimiter {
+	return RateLimiter{store, limits}
+}
+
+/*
+Allow counts a request against the named limit for the key, e.g. a mobile
+number or client IP, and returns a 429 error carrying the time until the
+window ends once the limit is exceeded. Requests without a key are not
+limited. When the store fails requests are allowed, so an outage of a shared
+store does not lock everybody out.
+*/
+func (l RateLimiter) Allow(name string, key string) *errs.AppError {
+	limit, ok := l.limits[name]
+	if !ok || key == "" {
+		return nil
+	}
+	hits, resetIn, appErr := l.store.Hit(name+":"+strings.ToLower(key), limit.Window)
+	if appErr != nil {
+		return nil
+	}
+	if hits > limit.Limit {
+		return errs.NewTooManyRequestsError("too many requests, try again later", resetIn)
+	}
+	return nil
+}
+
+type rateLimitWindow struct {
+	hits int
+	ends time.Time
+}
+
+// MemoryRateLimitStore keeps the counters of a single instance in memory.
+type MemoryRateLimitStore struct {
+	mu        *sync.Mutex
+	windows   map[string]*rateLimitWindow
+	lastSweep *time.Time
+}
+
+func NewMemoryRateLimitStore() MemoryRateLimitStore {
+	now := time.Now()
+	return MemoryRateLimitStore{&sync.Mutex{}, make(map[string]*rateLimitWindow), &now}
+}
+
+func (s MemoryRateLimitStore) Hit(key string, window time.Duration) (int, time.Duration, *errs.AppError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(*s.lastSweep) > time.Minute {
+		s.deleteExpired(now)
+	}
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.ends) {
+		w = &rateLimitWindow{ends: now.Add(window)}
+		s.windows[key] = w
+	}
+	w.hits++
+	return w.hits, w.ends.Sub(now), nil
+}
+
+func (s MemoryRateLimitStore) DeleteExpired() *errs.AppError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteExpired(time.Now())
+	return nil
+}
+
+func (s MemoryRateLimitStore) deleteExpired(now time.Time) {
+	for key, w := range s.windows {
+		if !now.Before(w.ends) {
+			delete(s.windows, key)
+		}
+	}
+	*s.lastSweep = now
+}
+
+/*
+RateLimitStoreDb shares the counters between instances through the
+rate_limits table:
+
+	rl_key varchar(191) primary key, hits int not null,
+	window_ends datetime(3) not null
+*/
+type RateLimitStoreDb struct {
+	client *sqlx.DB
+}
+
+func (d RateLimitStoreDb) Hit(key string, window time.Duration) (int, time.Duration, *errs.AppError) {
+	tx, err := d.client.Beginx()
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return 0, 0, errs.NewUnexpectedError("unexpected database error")
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	ends := now.Add(window)
+	sqlUpsert := `insert into rate_limits (rl_key, hits, window_ends) values (?, 1, ?)
+		on duplicate key update hits = if(window_ends <= ?, 1, hits + 1), window_ends = if(window_ends <= ?, ?, window_ends)`
+	if _, err = tx.Exec(sqlUpsert, key, ends, now, now, ends); err != nil {
+		logger.Error("Error while counting rate limited request: " + err.Error())
+		return 0, 0, errs.NewUnexpectedError("unexpected database error")
+	}
+	var row struct {
+		Hits       int       `db:"hits"`
+		WindowEnds time.Time `db:"window_ends"`
+	}
+	if err = tx.Get(&row, "select hits, window_ends from rate_limits where rl_key = ?", key); err != nil {
+		logger.Error("Error while counting rate limited request: " + err.Error())
+		return 0, 0, errs.NewUnexpectedError("unexpected database error")
+	}
+	if err = tx.Commit(); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return 0, 0, errs.NewUnexpectedError("unexpected database error")
+	}
+	return row.Hits, row.WindowEnds.Sub(now), nil
+}
+
+func (d RateLimitStoreDb) DeleteExpired() *errs.AppError {
+	sqlDelete := "delete from rate_limits where window_ends <= ?"
+	if _, err := d.client.Exec(sqlDelete, time.Now()); err != nil {
+		logger.Error("Error while purging rate limits: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+func NewRateLimitStore(client *sqlx.DB) RateLimitStoreDb {
+	return RateLimitStoreDb{client}
+}
@@ -0,0 +1,132 @@
+package domain
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RateLimit
+		wantErr bool
+	}{
+		{"5/1h", RateLimit{5, time.Hour}, false},
+		{"10/15m", RateLimit{10, 15 * time.Minute}, false},
+		{"1/30s", RateLimit{1, 30 * time.Second}, false},
+		{"5", RateLimit{}, true},
+		{"0/1h", RateLimit{}, true},
+		{"-1/1h", RateLimit{}, true},
+		{"x/1h", RateLimit{}, true},
+		{"5/1y", RateLimit{}, true},
+		{"5/0s", RateLimit{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRateLimit(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseRateLimit(%q) = %v, %v, want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Hit(string, time.Duration) (int, time.Duration, *errs.AppError) {
+	return 0, 0, errs.NewUnexpectedError("unexpected database error")
+}
+
+func (failingRateLimitStore) DeleteExpired() *errs.AppError {
+	return nil
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	limits := map[string]RateLimit{
+		RateLimitOtpMobile: {2, time.Hour},
+		RateLimitOtpIp:     {3, time.Hour},
+	}
+	type hit struct {
+		name    string
+		key     string
+		limited bool
+	}
+	tests := []struct {
+		name  string
+		store RateLimitStore
+		hits  []hit
+	}{
+		{"limit exceeded", NewMemoryRateLimitStore(), []hit{
+			{RateLimitOtpMobile, "9999999999", false},
+			{RateLimitOtpMobile, "9999999999", false},
+			{RateLimitOtpMobile, "9999999999", true},
+			{RateLimitOtpMobile, "9999999999", true},
+		}},
+		{"keys counted apart", NewMemoryRateLimitStore(), []hit{
+			{RateLimitOtpMobile, "9999999999", false},
+			{RateLimitOtpMobile, "9999999999", false},
+			{RateLimitOtpMobile, "8888888888", false},
+		}},
+		{"limits counted apart", NewMemoryRateLimitStore(), []hit{
+			{RateLimitOtpMobile, "10.0.0.1", false},
+			{RateLimitOtpMobile, "10.0.0.1", false},
+			{RateLimitOtpIp, "10.0.0.1", false},
+		}},
+		{"keys case insensitive", NewMemoryRateLimitStore(), []hit{
+			{RateLimitOtpMobile, "Alice", false},
+			{RateLimitOtpMobile, "alice", false},
+			{RateLimitOtpMobile, "ALICE", true},
+		}},
+		{"unconfigured limit", NewMemoryRateLimitStore(), []hit{
+			{RateLimitLoginUsername, "alice", false},
+			{RateLimitLoginUsername, "alice", false},
+			{RateLimitLoginUsername, "alice", false},
+		}},
+		{"no key", NewMemoryRateLimitStore(), []hit{
+			{RateLimitOtpMobile, "", false},
+			{RateLimitOtpMobile, "", false},
+			{RateLimitOtpMobile, "", false},
+		}},
+		{"failing store", failingRateLimitStore{}, []hit{
+			{RateLimitOtpMobile, "9999999999", false},
+			{RateLimitOtpMobile, "9999999999", false},
+			{RateLimitOtpMobile, "9999999999", false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(tt.store, limits)
+			for i, h := range tt.hits {
+				appErr := limiter.Allow(h.name, h.key)
+				if (appErr != nil) != h.limited {
+					t.Fatalf("hit %d on %s %q: Allow = %v, want limited %v", i+1, h.name, h.key, appErr, h.limited)
+				}
+				if appErr != nil && (appErr.Code != http.StatusTooManyRequests || appErr.RetryAfter < 1) {
+					t.Errorf("hit %d: Allow = %+v, want a 429 with Retry-After", i+1, appErr)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimitStoreWindowEnds(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	window := 50 * time.Millisecond
+	for want := 1; want <= 2; want++ {
+		if hits, _, _ := store.Hit("key", window); hits != want {
+			t.Fatalf("hits = %d, want %d", hits, want)
+		}
+	}
+	time.Sleep(window)
+	if hits, resetIn, _ := store.Hit("key", window); hits != 1 || resetIn <= 0 || resetIn > window {
+		t.Errorf("hit after the window = %d, %v, want 1 in a new window", hits, resetIn)
+	}
+	time.Sleep(window)
+	store.DeleteExpired()
+	if len(store.windows) != 0 {
+		t.Errorf("%d windows left after DeleteExpired, want none", len(store.windows))
+	}
+}
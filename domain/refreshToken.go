@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+)
+
+const (
+	RefreshTokenActive  = "active"
+	RefreshTokenRotated = "rotated"
+	RefreshTokenRevoked = "revoked"
+)
+
+/*
+RefreshTokenRecord is a row of the refresh_token_store table:
+
+	refresh_token varchar(512) primary key, family_id varchar(32) null,
+	owner varchar(64) null, status varchar(10) default 'active',
+	created_on datetime default now(), rotated_on datetime null
+
+Every refresh hands out a new token in the family of the presented one, so
+only the newest token of a family is active. Tokens stored before rotation
+existed have no family, and tokens stored before owners were recorded no
+owner.
+*/
+type RefreshTokenRecord struct {
+	RefreshToken string         `db:"refresh_token"`
+	FamilyId     sql.NullString `db:"family_id"`
+	Owner        sql.NullString `db:"owner"`
+	Status       string         `db:"status"`
+}
+
+// The owner of a refresh token, also the subject of the tokens of the user,
+// names the table the user is kept in, as the ids of password logins and of
+// OTP users overlap.
+const (
+	TokenOwnerLogin = "users"
+	TokenOwnerUser  = "sanyukt_users"
+)
+
+func (l Login) TokenOwner() string {
+	return TokenOwnerLogin + ":" + strconv.FormatInt(l.UserId, 10)
+}
+
+func (u Users) TokenOwner() string {
+	return TokenOwnerUser + ":" + strconv.FormatInt(u.Id, 10)
+}
+
+// NewRandomId returns a random 128 bit hex encoded identifier.
+func NewRandomId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestTokenSubjectsNameTheirTable(t *testing.T) {
+	login := Login{UserId: 42, Username: "alice", CustomerId: sql.NullString{String: "2000", Valid: true}}
+	admin := Login{UserId: 42, Username: "admin"}
+	user := Users{Id: 42, Mobile: "9999999999"}
+	tests := []struct {
+		name    string
+		subject string
+		want    string
+	}{
+		{"login access token", login.ClaimsForAccessToken().Subject, "users:42"},
+		{"admin access token", admin.ClaimsForAccessToken().Subject, "users:42"},
+		{"login id token", login.ClaimsForIdToken().Subject, "users:42"},
+		{"otp user access token", user.ClaimsForAccessToken().Subject, "sanyukt_users:42"},
+		{"otp user id token", user.ClaimsForIdToken(true).Subject, "sanyukt_users:42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.subject != tt.want {
+				t.Errorf("Subject = %q, want %q", tt.subject, tt.want)
+			}
+		})
+	}
+}
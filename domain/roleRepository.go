@@ -0,0 +1,161 @@
+package domain
+
+import (
+	"database/sql"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type RoleRepository interface {
+	FindAll() ([]authz.Role, *errs.AppError)
+	Save(role authz.Role) *errs.AppError
+	Delete(name string) *errs.AppError
+}
+
+type RoleRepositoryDb struct {
+	client *sqlx.DB
+}
+
+func (d RoleRepositoryDb) FindAll() ([]authz.Role, *errs.AppError) {
+	roles := make([]authz.Role, 0)
+	if err := d.client.Select(&roles, "select role, description from roles order by role"); err != nil {
+		logger.Error("Error while loading roles: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	permissions := make([]struct {
+		Role      string `db:"role"`
+		RouteName string `db:"route_name"`
+		Effect    string `db:"effect"`
+	}, 0)
+	if err := d.client.Select(&permissions, "select role, route_name, effect from role_permissions order by role, route_name"); err != nil {
+		logger.Error("Error while loading role permissions: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	parents := make([]struct {
+		Role       string `db:"role"`
+		ParentRole string `db:"parent_role"`
+	}, 0)
+	if err := d.client.Select(&parents, "select role, parent_role from role_inheritance order by role, parent_role"); err != nil {
+		logger.Error("Error while loading role inheritance: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+
+	byName := make(map[string]*authz.Role, len(roles))
+	for i := range roles {
+		roles[i].Permissions = make([]string, 0)
+		roles[i].Denies = make([]string, 0)
+		roles[i].Inherits = make([]string, 0)
+		byName[roles[i].Name] = &roles[i]
+	}
+	for _, p := range permissions {
+		if role, ok := byName[p.Role]; ok {
+			if p.Effect == authz.PermissionDeny {
+				role.Denies = append(role.Denies, p.RouteName)
+			} else {
+				role.Permissions = append(role.Permissions, p.RouteName)
+			}
+		}
+	}
+	for _, p := range parents {
+		if role, ok := byName[p.Role]; ok {
+			role.Inherits = append(role.Inherits, p.ParentRole)
+		}
+	}
+	return roles, nil
+}
+
+// Save creates the role or replaces its description, permissions and parents.
+func (d RoleRepositoryDb) Save(role authz.Role) *errs.AppError {
+	tx, err := d.client.Beginx()
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	defer tx.Rollback()
+
+	sqlUpsert := "insert into roles (role, description) values (?, ?) on duplicate key update description = values(description)"
+	if _, err = tx.Exec(sqlUpsert, role.Name, role.Description); err != nil {
+		logger.Error("Error while saving role: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	if _, err = tx.Exec("delete from role_permissions where role = ?", role.Name); err != nil {
+		logger.Error("Error while saving role permissions: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	for effect, routeNames := range map[string][]string{authz.PermissionAllow: role.Permissions, authz.PermissionDeny: role.Denies} {
+		for _, routeName := range routeNames {
+			sqlInsert := "insert into role_permissions (role, route_name, effect) values (?, ?, ?)"
+			if _, err = tx.Exec(sqlInsert, role.Name, routeName, effect); err != nil {
+				logger.Error("Error while saving role permissions: " + err.Error())
+				return errs.NewUnexpectedError("unexpected database error")
+			}
+		}
+	}
+	if _, err = tx.Exec("delete from role_inheritance where role = ?", role.Name); err != nil {
+		logger.Error("Error while saving role inheritance: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	for _, parent := range role.Inherits {
+		if _, err = tx.Exec("insert into role_inheritance (role, parent_role) values (?, ?)", role.Name, parent); err != nil {
+			logger.Error("Error while saving role inheritance: " + err.Error())
+			return errs.NewUnexpectedError("unexpected database error")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+// Delete removes a role no user, client or other role refers to anymore.
+func (d RoleRepositoryDb) Delete(name string) *errs.AppError {
+	tx, err := d.client.Beginx()
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+	sqlInUse := `select exists (select 1 from users where role = ?) or exists (select 1 from user_roles where role = ?)
+		or exists (select 1 from clients where role = ?) or exists (select 1 from role_inheritance where parent_role = ?)`
+	if err = tx.Get(&inUse, sqlInUse, name, name, name, name); err != nil {
+		logger.Error("Error while deleting role: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	if inUse {
+		return errs.NewConflictError("role is still assigned to users or clients, or inherited by other roles")
+	}
+	if _, err = tx.Exec("delete from role_permissions where role = ?", name); err != nil {
+		logger.Error("Error while deleting role permissions: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	if _, err = tx.Exec("delete from role_inheritance where role = ?", name); err != nil {
+		logger.Error("Error while deleting role inheritance: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	var result sql.Result
+	if result, err = tx.Exec("delete from roles where role = ?", name); err != nil {
+		logger.Error("Error while deleting role: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errs.NewNotFoundError("role not found")
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+func NewRoleRepository(client *sqlx.DB) RoleRepositoryDb {
+	return RoleRepositoryDb{client}
+}
@@ -0,0 +1,135 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+)
+
+/*
+RouteMapping names the banking API route serving a method and path, for
+proxies that see the request but not its route name. Path segments like
+{customer_id} are request parameters, optionally with a pattern as in
+{customer_id:[0-9]+}. An empty method or "*" matches every method.
+*/
+type RouteMapping struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	RouteName string `json:"route_name"`
+}
+
+// RouteMap finds the route name of a request, the first matching mapping
+// wins.
+type RouteMap struct {
+	mappings []RouteMapping
+	patterns []*regexp.Regexp
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*)(?::([^{}]+))?\}`)
+
+// NewRouteMap checks that every mapping names a route and compiles its path.
+func NewRouteMap(mappings []RouteMapping) (*RouteMap, error) {
+	m := &RouteMap{mappings: mappings, patterns: make([]*regexp.Regexp, len(mappings))}
+	for i, mapping := range mappings {
+		if mapping.RouteName == "" {
+			return nil, fmt.Errorf("route mapping %s %s: missing route name", mapping.Method, mapping.Path)
+		}
+		pattern, err := compilePath(mapping.Path)
+		if err != nil {
+			return nil, fmt.Errorf("route mapping %s %s: %w", mapping.Method, mapping.Path, err)
+		}
+		m.patterns[i] = pattern
+	}
+	return m, nil
+}
+
+func compilePath(path string) (*regexp.Regexp, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path must start with /")
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	last := 0
+	for _, loc := range pathParamPattern.FindAllStringSubmatchIndex(path, -1) {
+		expr.WriteString(regexp.QuoteMeta(path[last:loc[0]]))
+		segment := `[^/]+`
+		if loc[4] >= 0 {
+			segment = path[loc[4]:loc[5]]
+		}
+		expr.WriteString(fmt.Sprintf("(?P<%s>%s)", path[loc[2]:loc[3]], segment))
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(path[last:]))
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// RouteNames returns the routes permissions can be granted for: the routes of
+// the protected API named in the mappings and the admin routes of this server.
+func (m *RouteMap) RouteNames() []string {
+	names := make([]string, 0, len(m.mappings)+len(authz.AdminRouteNames))
+	for _, mapping := range m.mappings {
+		if !contains(names, mapping.RouteName) {
+			names = append(names, mapping.RouteName)
+		}
+	}
+	return append(names, authz.AdminRouteNames...)
+}
+
+// Match returns the route name and the path parameters of the request, the
+// path is without the query string.
+func (m *RouteMap) Match(method string, path string) (string, map[string]string, bool) {
+	for i, mapping := range m.mappings {
+		if mapping.Method != "" && mapping.Method != "*" && !strings.EqualFold(mapping.Method, method) {
+			continue
+		}
+		values := m.patterns[i].FindStringSubmatch(path)
+		if values == nil {
+			continue
+		}
+		params := make(map[string]string)
+		for j, name := range m.patterns[i].SubexpNames() {
+			if name != "" {
+				params[name] = values[j]
+			}
+		}
+		return mapping.RouteName, params, true
+	}
+	return "", nil, false
+}
+
+// DefaultRouteMap maps the routes of the banking API.
+func DefaultRouteMap() *RouteMap {
+	m, err := NewRouteMap([]RouteMapping{
+		{Method: "GET", Path: "/customers", RouteName: "GetAllCustomers"},
+		{Method: "GET", Path: "/customers/{customer_id:[0-9]+}", RouteName: "GetCustomer"},
+		{Method: "POST", Path: "/customers/{customer_id:[0-9]+}/account", RouteName: "NewAccount"},
+		{Method: "POST", Path: "/customers/{customer_id:[0-9]+}/account/{account_id:[0-9]+}", RouteName: "NewTransaction"},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// LoadRouteMap reads the route mappings from a JSON file holding a list of
+// them.
+func LoadRouteMap(path string) (*RouteMap, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mappings []RouteMapping
+	if err = json.Unmarshal(b, &mappings); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m, err := NewRouteMap(mappings)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// SecretCipher encrypts secrets the server has to read back, like TOTP
+// secrets, with AES-256-GCM so a copy of the database alone does not reveal
+// them.
+type SecretCipher struct {
+	aead cipher.AEAD
+}
+
+// NewSecretCipher derives the AES key from the configured key material.
+func NewSecretCipher(key []byte) (SecretCipher, error) {
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return SecretCipher{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return SecretCipher{}, err
+	}
+	return SecretCipher{aead}, nil
+}
+
+// Encrypt returns the base64 encoded nonce and ciphertext.
+func (c SecretCipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+func (c SecretCipher) Decrypt(encrypted string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(b) < c.aead.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	plaintext, err := c.aead.Open(nil, b[:c.aead.NonceSize()], b[c.aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
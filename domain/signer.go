@@ -0,0 +1,155 @@
+package domain
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Signer signs tokens with a single key and verifies the tokens signed with it.
+// Every token signed carries the key id in its "kid" header.
+type Signer interface {
+	Kid() string
+	Method() jwt.SigningMethod
+	Sign(token *jwt.Token) (string, error)
+	KeyFunc(token *jwt.Token) (interface{}, error)
+	JWK() (authz.JWK, bool)
+}
+
+type keySigner struct {
+	kid             string
+	method          jwt.SigningMethod
+	signingKey      interface{}
+	verificationKey interface{}
+}
+
+func (s keySigner) Kid() string {
+	return s.kid
+}
+
+func (s keySigner) Method() jwt.SigningMethod {
+	return s.method
+}
+
+func (s keySigner) Sign(token *jwt.Token) (string, error) {
+	if token.Method.Alg() != s.method.Alg() {
+		return "", fmt.Errorf("token method %s does not match signer method %s", token.Method.Alg(), s.method.Alg())
+	}
+	token.Header["kid"] = s.kid
+	return token.SignedString(s.signingKey)
+}
+
+func (s keySigner) KeyFunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != s.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	// tokens issued before key ids were introduced have no kid header
+	if kid, ok := token.Header["kid"]; ok && kid != s.kid {
+		return nil, fmt.Errorf("unknown key id: %v", kid)
+	}
+	return s.verificationKey, nil
+}
+
+func (s keySigner) JWK() (authz.JWK, bool) {
+	return authz.NewJWK(s.kid, s.method.Alg(), s.verificationKey)
+}
+
+// NewHMACSigner creates a signer for the HS256/HS384/HS512 algorithms. When
+// kid is empty it is derived from the secret.
+func NewHMACSigner(kid string, alg string, secret []byte) (Signer, error) {
+	method, ok := jwt.GetSigningMethod(alg).(*jwt.SigningMethodHMAC)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an HMAC algorithm", alg)
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("empty HMAC secret")
+	}
+	if kid == "" {
+		sum := sha256.Sum256(secret)
+		kid = base64.RawURLEncoding.EncodeToString(sum[:8])
+	}
+	return keySigner{kid: kid, method: method, signingKey: secret, verificationKey: secret}, nil
+}
+
+// NewSigner creates a signer for an asymmetric private key. The key type must
+// match the algorithm: RSA keys for RS*/PS*, ECDSA keys on the matching curve
+// for ES* and Ed25519 keys for EdDSA. When kid is empty the RFC 7638
+// thumbprint of the public key is used.
+func NewSigner(kid string, alg string, privateKey interface{}) (Signer, error) {
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported signing algorithm %s", alg)
+	}
+
+	var publicKey interface{}
+	switch k := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if !strings.HasPrefix(alg, "RS") && !strings.HasPrefix(alg, "PS") {
+			return nil, fmt.Errorf("RSA key can not be used with %s", alg)
+		}
+		publicKey = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		if curve, ok := ecdsaCurves[alg]; !ok || curve != k.Curve {
+			return nil, fmt.Errorf("ECDSA key on curve %s can not be used with %s", k.Curve.Params().Name, alg)
+		}
+		publicKey = &k.PublicKey
+	case ed25519.PrivateKey:
+		if alg != authz.SigningMethodEdDSA.Alg() {
+			return nil, fmt.Errorf("Ed25519 key can not be used with %s", alg)
+		}
+		publicKey = k.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+
+	if kid == "" {
+		jwk, _ := authz.NewJWK("", alg, publicKey)
+		kid = jwk.Thumbprint()
+	}
+	return keySigner{kid: kid, method: method, signingKey: privateKey, verificationKey: publicKey}, nil
+}
+
+// NewSignerFromPEM creates a signer from a PEM encoded PKCS#8, PKCS#1 or SEC 1
+// private key.
+func NewSignerFromPEM(kid string, alg string, pemBytes []byte) (Signer, error) {
+	privateKey, err := parsePrivateKeyPEM(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(kid, alg, privateKey)
+}
+
+var ecdsaCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+func parsePrivateKeyPEM(pemBytes []byte) (interface{}, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported private key in PEM block %q", block.Type)
+}
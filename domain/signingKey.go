@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+)
+
+const hmacSecretPEMType = "HMAC SECRET"
+
+/*
+SigningKey is a key as persisted in the signing_keys table:
+
+	kid varchar(64) primary key, alg varchar(10), private_key text,
+	status varchar(10), created_on datetime, retired_on datetime null
+
+The private key is PEM encoded, PKCS#8 for asymmetric keys and a raw
+"HMAC SECRET" block for HMAC secrets, and stored encrypted.
+*/
+type SigningKey struct {
+	Kid        string    `db:"kid"`
+	Alg        string    `db:"alg"`
+	PrivateKey string    `db:"private_key"`
+	Status     string    `db:"status"`
+	CreatedOn  time.Time `db:"created_on"`
+}
+
+const (
+	SigningKeyActive  = "active"
+	SigningKeyRetired = "retired"
+)
+
+func (k SigningKey) Signer() (Signer, error) {
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block != nil && block.Type == hmacSecretPEMType {
+		return NewHMACSigner(k.Kid, k.Alg, block.Bytes)
+	}
+	return NewSignerFromPEM(k.Kid, k.Alg, []byte(k.PrivateKey))
+}
+
+// NewSigningKey returns the persistable form of a signer.
+func NewSigningKey(signer Signer) (SigningKey, error) {
+	s, ok := signer.(keySigner)
+	if !ok {
+		return SigningKey{}, fmt.Errorf("unsupported signer type %T", signer)
+	}
+	var block *pem.Block
+	if secret, ok := s.signingKey.([]byte); ok {
+		block = &pem.Block{Type: hmacSecretPEMType, Bytes: secret}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(s.signingKey)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	return SigningKey{
+		Kid:        s.kid,
+		Alg:        s.method.Alg(),
+		PrivateKey: string(pem.EncodeToMemory(block)),
+		Status:     SigningKeyActive,
+		CreatedOn:  time.Now(),
+	}, nil
+}
+
+// GenerateSigner creates a signer with a fresh random key for the algorithm.
+func GenerateSigner(alg string) (Signer, error) {
+	var privateKey interface{}
+	var err error
+	switch {
+	case strings.HasPrefix(alg, "HS"):
+		secret := make([]byte, 64)
+		if _, err = rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return NewHMACSigner("", alg, secret)
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case strings.HasPrefix(alg, "ES"):
+		curve, ok := ecdsaCurves[alg]
+		if !ok {
+			return nil, fmt.Errorf("unsupported signing algorithm %s", alg)
+		}
+		privateKey, err = ecdsa.GenerateKey(curve, rand.Reader)
+	case alg == authz.SigningMethodEdDSA.Alg():
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %s", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner("", alg, privateKey)
+}
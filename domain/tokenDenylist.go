@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"github.com/jmoiron/sqlx"
+)
+
+/*
+TokenDenylist holds the ids of revoked access tokens until they would have
+expired anyway. It is backed by the token_denylist table:
+
+	jti varchar(32) primary key, expires_on datetime
+*/
+type TokenDenylist interface {
+	Add(jti string, expiresOn time.Time) *errs.AppError
+	Contains(jti string) (bool, *errs.AppError)
+	DeleteExpired() *errs.AppError
+}
+
+type TokenDenylistDb struct {
+	client *sqlx.DB
+}
+
+func (d TokenDenylistDb) Add(jti string, expiresOn time.Time) *errs.AppError {
+	sqlInsert := "insert ignore into token_denylist (jti, expires_on) values (?, ?)"
+	if _, err := d.client.Exec(sqlInsert, jti, expiresOn); err != nil {
+		logger.Error("Error while adding token to the denylist: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+// Contains ignores entries past their expiry, so they stop counting even
+// before DeleteExpired removes them.
+func (d TokenDenylistDb) Contains(jti string) (bool, *errs.AppError) {
+	sqlSelect := "select jti from token_denylist where jti = ? and expires_on > ?"
+	var found string
+	err := d.client.Get(&found, sqlSelect, jti, time.Now())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		logger.Error("Error while checking the token denylist: " + err.Error())
+		return false, errs.NewUnexpectedError("unexpected database error")
+	}
+	return true, nil
+}
+
+func (d TokenDenylistDb) DeleteExpired() *errs.AppError {
+	sqlDelete := "delete from token_denylist where expires_on <= ?"
+	if _, err := d.client.Exec(sqlDelete, time.Now()); err != nil {
+		logger.Error("Error while purging the token denylist: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+func NewTokenDenylist(client *sqlx.DB) TokenDenylistDb {
+	return TokenDenylistDb{client}
+}
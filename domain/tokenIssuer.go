@@ -0,0 +1,144 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TokenIssuer issues the tokens handed out to an authenticated principal,
+// whichever way it authenticated.
+type TokenIssuer interface {
+	NewAccessToken(claims authz.AccessTokenClaims) (string, *errs.AppError)
+	NewRefreshToken(claims authz.AccessTokenClaims, authTime time.Time, ttl time.Duration) (string, *errs.AppError)
+	NewIdToken(claims IdTokenClaims) (string, *errs.AppError)
+	NewMfaChallengeToken(claims MfaChallengeClaims) (string, *errs.AppError)
+	Issuer() string
+}
+
+// TokenValidator verifies the signature, expiry and type of the tokens issued
+// by a TokenIssuer. Errors are *jwt.ValidationError, so callers can tell an
+// expired token from an invalid one.
+type TokenValidator interface {
+	ValidateAccessToken(tokenString string) (*authz.AccessTokenClaims, error)
+	ValidateRefreshToken(tokenString string) (*RefreshTokenClaims, error)
+	ValidateMfaChallengeToken(tokenString string) (*MfaChallengeClaims, error)
+}
+
+// JwtTokenService issues and validates JWTs signed with the keys of a key ring.
+type JwtTokenService struct {
+	keys   *KeyRing
+	issuer string
+}
+
+func (s JwtTokenService) NewAccessToken(claims authz.AccessTokenClaims) (string, *errs.AppError) {
+	claims.Issuer = s.issuer
+	return NewAuthToken(claims, s.keys.Signer()).NewAccessToken()
+}
+
+// NewRefreshToken issues a refresh token of the family started by the login
+// at authTime.
+func (s JwtTokenService) NewRefreshToken(claims authz.AccessTokenClaims, authTime time.Time, ttl time.Duration) (string, *errs.AppError) {
+	claims.Issuer = s.issuer
+	return NewAuthToken(claims, s.keys.Signer()).newRefreshToken(authTime, ttl)
+}
+
+// NewIdToken signs an OpenID Connect ID token. Without an audience the token
+// is addressed to the issuer itself.
+func (s JwtTokenService) NewIdToken(claims IdTokenClaims) (string, *errs.AppError) {
+	now := time.Now()
+	claims.Issuer = s.issuer
+	if claims.Audience == "" {
+		claims.Audience = s.issuer
+	}
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(ID_TOKEN_DURATION).Unix()
+	if claims.AuthTime == 0 {
+		claims.AuthTime = claims.IssuedAt
+	}
+
+	signer := s.keys.Signer()
+	signedString, err := signer.Sign(jwt.NewWithClaims(signer.Method(), claims))
+	if err != nil {
+		logger.Error("Failed while signing id token: " + err.Error())
+		return "", errs.NewUnexpectedError("cannot generate id token")
+	}
+	return signedString, nil
+}
+
+// NewMfaChallengeToken signs the token a login with a pending second factor
+// is completed with, it is addressed to the issuer itself.
+func (s JwtTokenService) NewMfaChallengeToken(claims MfaChallengeClaims) (string, *errs.AppError) {
+	now := time.Now()
+	claims.TokenType = authz.TokenTypeMfaChallenge
+	claims.Issuer = s.issuer
+	claims.Audience = s.issuer
+	claims.Id = NewRandomId()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(MFA_CHALLENGE_DURATION).Unix()
+
+	signer := s.keys.Signer()
+	signedString, err := signer.Sign(jwt.NewWithClaims(signer.Method(), claims))
+	if err != nil {
+		logger.Error("Failed while signing mfa challenge token: " + err.Error())
+		return "", errs.NewUnexpectedError("cannot generate mfa challenge token")
+	}
+	return signedString, nil
+}
+
+func (s JwtTokenService) Issuer() string {
+	return s.issuer
+}
+
+func (s JwtTokenService) ValidateAccessToken(tokenString string) (*authz.AccessTokenClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &authz.AccessTokenClaims{}, s.keys.KeyFunc)
+	if err != nil {
+		return nil, err
+	}
+	claims := token.Claims.(*authz.AccessTokenClaims)
+	// tokens issued before token types were introduced carry none
+	if claims.TokenType != "" && claims.TokenType != authz.TokenTypeAccess {
+		return nil, invalidTokenType(claims.TokenType)
+	}
+	return claims, nil
+}
+
+func (s JwtTokenService) ValidateRefreshToken(tokenString string) (*RefreshTokenClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &RefreshTokenClaims{}, s.keys.KeyFunc)
+	if err != nil {
+		return nil, err
+	}
+	claims := token.Claims.(*RefreshTokenClaims)
+	if claims.TokenType != authz.TokenTypeRefresh {
+		return nil, invalidTokenType(claims.TokenType)
+	}
+	return claims, nil
+}
+
+func (s JwtTokenService) ValidateMfaChallengeToken(tokenString string) (*MfaChallengeClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &MfaChallengeClaims{}, s.keys.KeyFunc)
+	if err != nil {
+		return nil, err
+	}
+	claims := token.Claims.(*MfaChallengeClaims)
+	if claims.TokenType != authz.TokenTypeMfaChallenge {
+		return nil, invalidTokenType(claims.TokenType)
+	}
+	return claims, nil
+}
+
+func invalidTokenType(tokenType string) *jwt.ValidationError {
+	return &jwt.ValidationError{
+		Inner:  errors.New("unexpected token type " + tokenType),
+		Errors: jwt.ValidationErrorClaimsInvalid,
+	}
+}
+
+func NewJwtTokenService(keys *KeyRing, issuer string) JwtTokenService {
+	return JwtTokenService{keys, issuer}
+}
@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+// the SHA1 secret of the RFC 6238 test vectors, "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTotpRfc6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B, the SHA1 codes cut to 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			step, ok := ValidateTotp(rfc6238Secret, tt.code, time.Unix(tt.unix, 0), 0)
+			if !ok {
+				t.Fatalf("ValidateTotp rejected the code for %d", tt.unix)
+			}
+			if want := tt.unix / 30; step != want {
+				t.Errorf("step = %d, want %d", step, want)
+			}
+		})
+	}
+}
+
+func TestValidateTotp(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / 30
+	tests := []struct {
+		name         string
+		secret       string
+		code         string
+		now          time.Time
+		lastUsedStep int64
+		want         bool
+	}{
+		{"current step", rfc6238Secret, "050471", now, 0, true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", now, 0, true},
+		{"previous step within skew", rfc6238Secret, "050471", now.Add(30 * time.Second), 0, true},
+		{"next step within skew", rfc6238Secret, "050471", now.Add(-30 * time.Second), 0, true},
+		{"beyond skew", rfc6238Secret, "050471", now.Add(90 * time.Second), 0, false},
+		{"replayed step", rfc6238Secret, "050471", now, current, false},
+		{"after an older step", rfc6238Secret, "050471", now, current - 1, true},
+		{"wrong code", rfc6238Secret, "050472", now, 0, false},
+		{"too short", rfc6238Secret, "50471", now, 0, false},
+		{"invalid secret", "not base32!", "050471", now, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := ValidateTotp(tt.secret, tt.code, tt.now, tt.lastUsedStep); got != tt.want {
+				t.Errorf("ValidateTotp = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
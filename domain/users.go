@@ -2,14 +2,56 @@ package domain
 
 import (
 	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+
+	"github.com/dgrijalva/jwt-go"
 )
 
+// Users is a row of the sanyukt_users table. user_email varchar(255) null is
+// where OTPs are sent when they are delivered by email.
 type Users struct {
-	Id        int64          `db:"user_id"`
-	Name      sql.NullString `db:"user_name,omitempty"`
-	Mobile    string         `db:"user_mobile"`
-	Otp       string         `db:"user_otp"`
-	Role      string         `db:"user_role"`
-	CreatedOn string         `db:"created_on"`
-	UpdateOn  string         `db:"UpdatedOn"`
+	Id          int64          `db:"user_id"`
+	Name        sql.NullString `db:"user_name,omitempty"`
+	Mobile      string         `db:"user_mobile"`
+	Email       sql.NullString `db:"user_email"`
+	Otp         string         `db:"user_otp"`
+	OtpVerified sql.NullBool   `db:"otp_verified"`
+	Role        string         `db:"user_role"`
+	CreatedOn   string         `db:"created_on"`
+	UpdateOn    string         `db:"UpdatedOn"`
+}
+
+/*
+ClaimsForAccessToken builds the claims for a user that logged in with an OTP.
+These users are not linked to a customer, so the token carries no customer
+id and the ownership checks of the "user" role deny them every customer.
+*/
+func (u Users) ClaimsForAccessToken() authz.AccessTokenClaims {
+	userId := strconv.FormatInt(u.Id, 10)
+	return authz.AccessTokenClaims{
+		UserId:   userId,
+		Accounts: []string{},
+		Username: u.Name.String,
+		Role:     u.Role,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   u.TokenOwner(),
+			ExpiresAt: time.Now().Add(ACCESS_TOKEN_DURATION).Unix(),
+		},
+	}
+}
+
+// ClaimsForIdToken describes the user to OpenID Connect clients. The mobile
+// number is verified when the user logs in with an OTP sent to it.
+func (u Users) ClaimsForIdToken(phoneNumberVerified bool) IdTokenClaims {
+	return IdTokenClaims{
+		PreferredUsername:   u.Name.String,
+		PhoneNumber:         u.Mobile,
+		PhoneNumberVerified: phoneNumberVerified,
+		StandardClaims: jwt.StandardClaims{
+			Subject: u.TokenOwner(),
+		},
+	}
 }
@@ -0,0 +1,458 @@
+package domain
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	WEBAUTHN_CHALLENGE_DURATION = 5 * time.Minute
+	LoginMethodPasskey          = "passkey"
+
+	// the ceremonies a stored challenge can be answered by
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+	WebAuthnCeremonyMfa          = "mfa"
+)
+
+/*
+WebAuthnCredential is a passkey or security key of a user, kept in the
+webauthn_credentials table:
+
+	credential_id varchar(255) primary key, user_id int not null,
+	public_key blob not null, attestation_type varchar(32), aaguid varbinary(16),
+	sign_count int unsigned not null default 0, transports varchar(255),
+	backup_eligible bool, backup_state bool, created_on datetime default now(),
+	last_used_on datetime null
+
+The credential id is base64url encoded and the transports comma separated.
+*/
+type WebAuthnCredential struct {
+	CredentialId    string         `db:"credential_id"`
+	UserId          int64          `db:"user_id"`
+	PublicKey       []byte         `db:"public_key"`
+	AttestationType string         `db:"attestation_type"`
+	AAGUID          []byte         `db:"aaguid"`
+	SignCount       uint32         `db:"sign_count"`
+	Transports      sql.NullString `db:"transports"`
+	BackupEligible  bool           `db:"backup_eligible"`
+	BackupState     bool           `db:"backup_state"`
+}
+
+func NewWebAuthnCredential(userId int64, c *webauthn.Credential) WebAuthnCredential {
+	transports := make([]string, len(c.Transport))
+	for i, t := range c.Transport {
+		transports[i] = string(t)
+	}
+	return WebAuthnCredential{
+		CredentialId:    base64.RawURLEncoding.EncodeToString(c.ID),
+		UserId:          userId,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		AAGUID:          c.Authenticator.AAGUID,
+		SignCount:       c.Authenticator.SignCount,
+		Transports:      sql.NullString{String: strings.Join(transports, ","), Valid: len(transports) > 0},
+		BackupEligible:  c.Flags.BackupEligible,
+		BackupState:     c.Flags.BackupState,
+	}
+}
+
+func (c WebAuthnCredential) AsCredential() webauthn.Credential {
+	id, _ := base64.RawURLEncoding.DecodeString(c.CredentialId)
+	var transports []protocol.AuthenticatorTransport
+	if c.Transports.Valid && c.Transports.String != "" {
+		for _, t := range strings.Split(c.Transports.String, ",") {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+	}
+	return webauthn.Credential{
+		ID:              id,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transport:       transports,
+		Flags:           webauthn.CredentialFlags{BackupEligible: c.BackupEligible, BackupState: c.BackupState},
+		Authenticator:   webauthn.Authenticator{AAGUID: c.AAGUID, SignCount: c.SignCount},
+	}
+}
+
+// webAuthnUser is a login as the WebAuthn library sees it, the user handle is
+// the user id.
+type webAuthnUser struct {
+	login       *Login
+	credentials []webauthn.Credential
+}
+
+func (u webAuthnUser) WebAuthnID() []byte {
+	return []byte(strconv.FormatInt(u.login.UserId, 10))
+}
+
+func (u webAuthnUser) WebAuthnName() string {
+	return u.login.Username
+}
+
+func (u webAuthnUser) WebAuthnDisplayName() string {
+	return u.login.Username
+}
+
+func (u webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+/*
+WebAuthnRepository keeps the credentials and the challenges of ceremonies in
+progress, in the webauthn_challenges table:
+
+	challenge varchar(128) primary key, ceremony varchar(16) not null,
+	user_id int null, session_data text not null, expires_on datetime not null
+
+A challenge is looked up by the value the authenticator signed and can only
+be answered once.
+*/
+type WebAuthnRepository interface {
+	FindCredentials(userId int64) ([]WebAuthnCredential, *errs.AppError)
+	SaveCredential(credential WebAuthnCredential) *errs.AppError
+	UpdateSignCount(credentialId string, signCount uint32, backupState bool) *errs.AppError
+	SaveChallenge(ceremony string, userId int64, session webauthn.SessionData) *errs.AppError
+	TakeChallenge(ceremony string, challenge string) (*webauthn.SessionData, *errs.AppError)
+	DeleteExpiredChallenges()
+}
+
+type WebAuthnRepositoryDb struct {
+	client *sqlx.DB
+}
+
+func (d WebAuthnRepositoryDb) FindCredentials(userId int64) ([]WebAuthnCredential, *errs.AppError) {
+	credentials := make([]WebAuthnCredential, 0)
+	sqlSelect := `select credential_id, user_id, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state
+		from webauthn_credentials where user_id = ?`
+	if err := d.client.Select(&credentials, sqlSelect, userId); err != nil {
+		logger.Error("Error while loading webauthn credentials: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	return credentials, nil
+}
+
+func (d WebAuthnRepositoryDb) SaveCredential(c WebAuthnCredential) *errs.AppError {
+	sqlInsert := `insert into webauthn_credentials (credential_id, user_id, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := d.client.Exec(sqlInsert, c.CredentialId, c.UserId, c.PublicKey, c.AttestationType, c.AAGUID, c.SignCount, c.Transports, c.BackupEligible, c.BackupState)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return errs.NewConflictError("credential already registered")
+		}
+		logger.Error("Error while saving webauthn credential: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+func (d WebAuthnRepositoryDb) UpdateSignCount(credentialId string, signCount uint32, backupState bool) *errs.AppError {
+	sqlUpdate := "update webauthn_credentials set sign_count = ?, backup_state = ?, last_used_on = now() where credential_id = ?"
+	if _, err := d.client.Exec(sqlUpdate, signCount, backupState, credentialId); err != nil {
+		logger.Error("Error while updating webauthn sign count: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+// SaveChallenge stores the session of a ceremony, userId is 0 for the login
+// with a discoverable credential where the user is not known yet.
+func (d WebAuthnRepositoryDb) SaveChallenge(ceremony string, userId int64, session webauthn.SessionData) *errs.AppError {
+	data, err := json.Marshal(session)
+	if err != nil {
+		logger.Error("Error while encoding webauthn session: " + err.Error())
+		return errs.NewUnexpectedError("unexpected error")
+	}
+	sqlInsert := "insert into webauthn_challenges (challenge, ceremony, user_id, session_data, expires_on) values (?, ?, ?, ?, ?)"
+	user := sql.NullInt64{Int64: userId, Valid: userId != 0}
+	if _, err = d.client.Exec(sqlInsert, session.Challenge, ceremony, user, string(data), session.Expires); err != nil {
+		logger.Error("Error while saving webauthn challenge: " + err.Error())
+		return errs.NewUnexpectedError("unexpected database error")
+	}
+	return nil
+}
+
+// TakeChallenge removes the challenge and returns its session, an unknown or
+// expired challenge is an authentication error.
+func (d WebAuthnRepositoryDb) TakeChallenge(ceremony string, challenge string) (*webauthn.SessionData, *errs.AppError) {
+	tx, err := d.client.Beginx()
+	if err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	defer tx.Rollback()
+
+	var data string
+	sqlSelect := "select session_data from webauthn_challenges where challenge = ? and ceremony = ? and expires_on > now() for update"
+	if err = tx.Get(&data, sqlSelect, challenge, ceremony); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errs.NewAuthenticationError("unknown or expired challenge")
+		}
+		logger.Error("Error while loading webauthn challenge: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	if _, err = tx.Exec("delete from webauthn_challenges where challenge = ?", challenge); err != nil {
+		logger.Error("Error while deleting webauthn challenge: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+	if err = tx.Commit(); err != nil {
+		logger.Error("unexpected database error: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected database error")
+	}
+
+	var session webauthn.SessionData
+	if err = json.Unmarshal([]byte(data), &session); err != nil {
+		logger.Error("Error while decoding webauthn session: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected error")
+	}
+	return &session, nil
+}
+
+func (d WebAuthnRepositoryDb) DeleteExpiredChallenges() {
+	if _, err := d.client.Exec("delete from webauthn_challenges where expires_on < now()"); err != nil {
+		logger.Error("Error while deleting expired webauthn challenges: " + err.Error())
+	}
+}
+
+func NewWebAuthnRepository(client *sqlx.DB) WebAuthnRepositoryDb {
+	return WebAuthnRepositoryDb{client}
+}
+
+/*
+WebAuthnRelyingParty runs the registration and assertion ceremonies of the
+server. Only "none" attestation is requested, the authenticator model is not
+checked against a metadata service.
+*/
+type WebAuthnRelyingParty struct {
+	webAuthn *webauthn.WebAuthn
+	repo     WebAuthnRepository
+}
+
+// HasCredentials tells whether the user registered a passkey.
+func (rp WebAuthnRelyingParty) HasCredentials(userId int64) (bool, *errs.AppError) {
+	credentials, appErr := rp.repo.FindCredentials(userId)
+	if appErr != nil {
+		return false, appErr
+	}
+	return len(credentials) > 0, nil
+}
+
+// BeginRegistration returns the options for navigator.credentials.create(),
+// excluding the credentials the user already has.
+func (rp WebAuthnRelyingParty) BeginRegistration(login *Login) (*protocol.CredentialCreation, *errs.AppError) {
+	user, appErr := rp.user(login)
+	if appErr != nil {
+		return nil, appErr
+	}
+	exclusions := make([]protocol.CredentialDescriptor, len(user.credentials))
+	for i, c := range user.credentials {
+		exclusions[i] = c.Descriptor()
+	}
+	creation, session, err := rp.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithConveyancePreference(protocol.PreferNoAttestation),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred))
+	if err != nil {
+		logger.Error("Error while starting webauthn registration: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected error")
+	}
+	if appErr = rp.saveChallenge(WebAuthnCeremonyRegistration, login.UserId, session); appErr != nil {
+		return nil, appErr
+	}
+	return creation, nil
+}
+
+// FinishRegistration verifies the response of navigator.credentials.create()
+// and stores the new credential.
+func (rp WebAuthnRelyingParty) FinishRegistration(login *Login, response []byte) (*WebAuthnCredential, *errs.AppError) {
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, errs.NewValidationError("invalid credential: " + protocolErrorDetails(err))
+	}
+	session, appErr := rp.repo.TakeChallenge(WebAuthnCeremonyRegistration, parsed.Response.CollectedClientData.Challenge)
+	if appErr != nil {
+		return nil, appErr
+	}
+	user, appErr := rp.user(login)
+	if appErr != nil {
+		return nil, appErr
+	}
+	// the session is bound to the user that started the ceremony
+	if !bytes.Equal(session.UserID, user.WebAuthnID()) {
+		return nil, errs.NewAuthenticationError("unknown or expired challenge")
+	}
+	created, err := rp.webAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, errs.NewValidationError("invalid credential: " + protocolErrorDetails(err))
+	}
+	credential := NewWebAuthnCredential(login.UserId, created)
+	if appErr = rp.repo.SaveCredential(credential); appErr != nil {
+		return nil, appErr
+	}
+	return &credential, nil
+}
+
+/*
+BeginLogin returns the options for navigator.credentials.get(). Without a
+login any discoverable credential is accepted, with a login only the
+credentials of that user are, for a second factor. A passwordless login
+replaces the password, so the authenticator has to verify the user.
+*/
+func (rp WebAuthnRelyingParty) BeginLogin(ceremony string, login *Login) (*protocol.CredentialAssertion, *errs.AppError) {
+	var assertion *protocol.CredentialAssertion
+	var session *webauthn.SessionData
+	var err error
+	var userId int64
+	if login == nil {
+		assertion, session, err = rp.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	} else {
+		user, appErr := rp.user(login)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if len(user.credentials) == 0 {
+			return nil, errs.NewNotFoundError("no passkey registered")
+		}
+		userId = login.UserId
+		assertion, session, err = rp.webAuthn.BeginLogin(user)
+	}
+	if err != nil {
+		logger.Error("Error while starting webauthn login: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected error")
+	}
+	if appErr := rp.saveChallenge(ceremony, userId, session); appErr != nil {
+		return nil, appErr
+	}
+	return assertion, nil
+}
+
+/*
+FinishLogin verifies the response of navigator.credentials.get() and returns
+the id of the user the credential belongs to. With a login the credential
+must belong to that user, without one the authenticator must have verified
+the user. A sign count going backwards means the credential was cloned, the
+assertion is rejected.
+*/
+func (rp WebAuthnRelyingParty) FinishLogin(ceremony string, login *Login, response []byte, findLogin func(userId int64) (*Login, *errs.AppError)) (int64, *errs.AppError) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return 0, errs.NewValidationError("invalid assertion: " + protocolErrorDetails(err))
+	}
+	session, appErr := rp.repo.TakeChallenge(ceremony, parsed.Response.CollectedClientData.Challenge)
+	if appErr != nil {
+		return 0, appErr
+	}
+
+	var user webAuthnUser
+	var credential *webauthn.Credential
+	if login != nil {
+		if user, appErr = rp.user(login); appErr != nil {
+			return 0, appErr
+		}
+		credential, err = rp.webAuthn.ValidateLogin(user, *session, parsed)
+	} else {
+		credential, err = rp.webAuthn.ValidateDiscoverableLogin(func(rawId, userHandle []byte) (webauthn.User, error) {
+			userId, err := strconv.ParseInt(string(userHandle), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			found, appErr := findLogin(userId)
+			if appErr != nil {
+				return nil, errors.New(appErr.Message)
+			}
+			if user, appErr = rp.user(found); appErr != nil {
+				return nil, errors.New(appErr.Message)
+			}
+			return user, nil
+		}, *session, parsed)
+	}
+	if err != nil {
+		logger.Debug("Passkey assertion rejected: " + protocolErrorDetails(err))
+		return 0, errs.NewAuthenticationError("invalid passkey")
+	}
+	if user.login == nil {
+		return 0, errs.NewAuthenticationError("invalid passkey")
+	}
+	if login == nil && !parsed.Response.AuthenticatorData.Flags.UserVerified() {
+		return 0, errs.NewAuthenticationError("passkey did not verify the user")
+	}
+
+	credentialId := base64.RawURLEncoding.EncodeToString(credential.ID)
+	if credential.Authenticator.CloneWarning {
+		logger.Warn("Security event: passkey sign count went backwards",
+			zap.String("event", "passkey_clone_warning"),
+			zap.Int64("user_id", user.login.UserId),
+			zap.String("credential_id", credentialId))
+		return 0, errs.NewAuthenticationError("invalid passkey")
+	}
+	if appErr = rp.repo.UpdateSignCount(credentialId, credential.Authenticator.SignCount, credential.Flags.BackupState); appErr != nil {
+		return 0, appErr
+	}
+	return user.login.UserId, nil
+}
+
+func (rp WebAuthnRelyingParty) user(login *Login) (webAuthnUser, *errs.AppError) {
+	stored, appErr := rp.repo.FindCredentials(login.UserId)
+	if appErr != nil {
+		return webAuthnUser{}, appErr
+	}
+	credentials := make([]webauthn.Credential, len(stored))
+	for i, c := range stored {
+		credentials[i] = c.AsCredential()
+	}
+	return webAuthnUser{login, credentials}, nil
+}
+
+func (rp WebAuthnRelyingParty) saveChallenge(ceremony string, userId int64, session *webauthn.SessionData) *errs.AppError {
+	if session.Expires.IsZero() {
+		session.Expires = time.Now().Add(WEBAUTHN_CHALLENGE_DURATION)
+	}
+	return rp.repo.SaveChallenge(ceremony, userId, *session)
+}
+
+func protocolErrorDetails(err error) string {
+	if protocolErr, ok := err.(*protocol.Error); ok && protocolErr.DevInfo != "" {
+		return protocolErr.Details + ": " + protocolErr.DevInfo
+	}
+	return err.Error()
+}
+
+/*
+NewWebAuthnRelyingParty configures the relying party, rpId is the domain the
+credentials are scoped to and origins the web origins the ceremonies may
+run on.
+*/
+func NewWebAuthnRelyingParty(rpId string, displayName string, origins []string, repo WebAuthnRepository) (WebAuthnRelyingParty, error) {
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:                  rpId,
+		RPDisplayName:         displayName,
+		RPOrigins:             origins,
+		AttestationPreference: protocol.PreferNoAttestation,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: WEBAUTHN_CHALLENGE_DURATION, TimeoutUVD: WEBAUTHN_CHALLENGE_DURATION},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: WEBAUTHN_CHALLENGE_DURATION, TimeoutUVD: WEBAUTHN_CHALLENGE_DURATION},
+		},
+	})
+	if err != nil {
+		return WebAuthnRelyingParty{}, err
+	}
+	return WebAuthnRelyingParty{webAuthn, repo}, nil
+}
@@ -1,15 +1,24 @@
 package errs
 
-import "net/http"
+import (
+	"math"
+	"net/http"
+	"time"
+)
 
 type AppError struct {
-	Code    int    `json:",omitempty"`
-	Message string `json:"message"`
+	Code      int    `json:",omitempty"`
+	ErrorCode string `json:"error,omitempty"`
+	Message   string `json:"message"`
+	// seconds until the request may be retried, sent as the Retry-After header
+	RetryAfter int `json:"-"`
 }
 
 func (e AppError) AsMessage() *AppError {
 	return &AppError{
-		Message: e.Message,
+		ErrorCode:  e.ErrorCode,
+		Message:    e.Message,
+		RetryAfter: e.RetryAfter,
 	}
 }
 
@@ -47,3 +56,31 @@ func NewAuthorizationError(message string) *AppError {
 		Code:    http.StatusForbidden,
 	}
 }
+
+func NewConflictError(message string) *AppError {
+	return &AppError{
+		Message: message,
+		Code:    http.StatusConflict,
+	}
+}
+
+// NewTooManyRequestsError rounds retryAfter up to whole seconds, so clients
+// never retry too early.
+func NewTooManyRequestsError(message string, retryAfter time.Duration) *AppError {
+	return &AppError{
+		Message:    message,
+		Code:       http.StatusTooManyRequests,
+		RetryAfter: int(math.Ceil(retryAfter.Seconds())),
+	}
+}
+
+// NewCodedError creates an error carrying a machine readable error code next
+// to the message, e.g. "otp_expired" or one of the RFC 6749 error codes like
+// "invalid_grant".
+func NewCodedError(code int, errorCode string, message string) *AppError {
+	return &AppError{
+		Message:   message,
+		ErrorCode: errorCode,
+		Code:      code,
+	}
+}
@@ -39,3 +39,7 @@ func Debug(message string, fields ...zap.Field) {
 func Error(message string, fields ...zap.Field) {
 	log.Error(message, fields...)
 }
+
+func Warn(message string, fields ...zap.Field) {
+	log.Warn(message, fields...)
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"sanyuktgolang/app"
+	"github.com/harishkokcha91/sanyuktgolang/app"
 )
 
 func main() {
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GinAuthenticate is Authenticate for gin, the claims are put in the context
+// of the request.
+func GinAuthenticate(v Validator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, code, message := authenticate(v, c.GetHeader("Authorization"))
+		if claims == nil {
+			c.AbortWithStatusJSON(code, notAuthorizedResponse(message))
+			return
+		}
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), claims))
+		c.Next()
+	}
+}
+
+// GinRequirePermission is RequirePermission for gin, it goes after
+// GinAuthenticate. The path parameters are the gin route parameters.
+func GinRequirePermission(permissions *authz.RolePermissions, policies *authz.PolicySet, routeName string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := GinClaims(c)
+		params := make(map[string]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = p.Value
+		}
+		request := authz.AccessRequest{
+			Claims:    claims,
+			RouteName: routeName,
+			Params:    params,
+			Method:    c.Request.Method,
+			ClientIp:  remoteIp(c.Request),
+			Time:      time.Now(),
+		}
+		if code, message := authorize(permissions, policies, request); code != http.StatusOK {
+			c.AbortWithStatusJSON(code, notAuthorizedResponse(message))
+			return
+		}
+		c.Next()
+	}
+}
+
+// GinClaims returns the claims GinAuthenticate put in the request context.
+func GinClaims(c *gin.Context) (*authz.AccessTokenClaims, bool) {
+	return ClaimsFromContext(c.Request.Context())
+}
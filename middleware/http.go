@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+
+	"github.com/gorilla/mux"
+)
+
+type claimsKey struct{}
+
+// NewContext returns a copy of ctx carrying the claims of a verified token.
+func NewContext(ctx context.Context, claims *authz.AccessTokenClaims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims Authenticate put in the context.
+func ClaimsFromContext(ctx context.Context) (*authz.AccessTokenClaims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*authz.AccessTokenClaims)
+	return claims, ok
+}
+
+// Authenticate rejects requests without a valid bearer token with a 401 and
+// puts the claims of the token in the context of the others.
+func Authenticate(v Validator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, code, message := authenticate(v, r.Header.Get("Authorization"))
+			if claims == nil {
+				writeNotAuthorized(w, code, message)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
+
+/*
+RequirePermission only lets requests through when the roles of the token are
+authorized for routeName and the policies, like DefaultPolicies, let the
+request pass, it goes after Authenticate. The role permissions alone do not
+check whose resource is requested, without policies a customer can access
+the customers and accounts of others. The path parameters are taken from
+gorilla/mux and the client IP from the connection.
+*/
+func RequirePermission(permissions *authz.RolePermissions, policies *authz.PolicySet, routeName string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
+			request := authz.AccessRequest{
+				Claims:    claims,
+				RouteName: routeName,
+				Params:    mux.Vars(r),
+				Method:    r.Method,
+				ClientIp:  remoteIp(r),
+				Time:      time.Now(),
+			}
+			if code, message := authorize(permissions, policies, request); code != http.StatusOK {
+				writeNotAuthorized(w, code, message)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoutePermission is RequirePermission for gorilla/mux routers, the
+// route name is the name of the matched route.
+func RequireRoutePermission(permissions *authz.RolePermissions, policies *authz.PolicySet) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			routeName := ""
+			if route := mux.CurrentRoute(r); route != nil {
+				routeName = route.GetName()
+			}
+			RequirePermission(permissions, policies, routeName)(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+func authenticate(v Validator, authorization string) (*authz.AccessTokenClaims, int, string) {
+	parts := strings.SplitN(authorization, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || strings.TrimSpace(parts[1]) == "" {
+		return nil, http.StatusUnauthorized, "missing token"
+	}
+	claims, err := v.ValidateAccessToken(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, http.StatusUnauthorized, err.Error()
+	}
+	return claims, http.StatusOK, ""
+}
+
+// authorize checks the role permissions and then the policies, a nil policy
+// set has none.
+func authorize(permissions *authz.RolePermissions, policies *authz.PolicySet, request authz.AccessRequest) (int, string) {
+	claims := request.Claims
+	if claims == nil {
+		return http.StatusUnauthorized, "missing token"
+	}
+	if request.RouteName == "" || !permissions.IsAuthorizedFor(claims.AllRoles(), request.RouteName) {
+		return http.StatusForbidden, strings.Join(claims.AllRoles(), ", ") + " role is not authorized"
+	}
+	if policies != nil {
+		request.Roles = permissions.EffectiveRoles(claims.AllRoles())
+		if decision := policies.Evaluate(request); !decision.Allowed {
+			return http.StatusForbidden, decision.Message
+		}
+	}
+	return http.StatusOK, ""
+}
+
+func remoteIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func notAuthorizedResponse(message string) map[string]interface{} {
+	return map[string]interface{}{
+		"isAuthorized": false,
+		"message":      message,
+	}
+}
+
+func writeNotAuthorized(w http.ResponseWriter, code int, message string) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(notAuthorizedResponse(message)); err != nil {
+		panic(err)
+	}
+}
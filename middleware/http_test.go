@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRequireRoutePermission(t *testing.T) {
+	permissions := authz.NewRolePermissions(authz.DefaultRoles())
+	customer := &authz.AccessTokenClaims{CustomerId: "2000", Accounts: []string{"95470"}, Role: authz.DefaultUserRole}
+	admin := &authz.AccessTokenClaims{Role: authz.AdminRole}
+	tests := []struct {
+		name     string
+		claims   *authz.AccessTokenClaims
+		policies *authz.PolicySet
+		method   string
+		path     string
+		wantCode int
+	}{
+		{"own customer", customer, authz.DefaultPolicies(), "GET", "/customers/2000", http.StatusOK},
+		{"other customer", customer, authz.DefaultPolicies(), "GET", "/customers/2001", http.StatusForbidden},
+		{"own account", customer, authz.DefaultPolicies(), "POST", "/customers/2000/account/95470", http.StatusOK},
+		{"other account", customer, authz.DefaultPolicies(), "POST", "/customers/2000/account/95471", http.StatusForbidden},
+		{"other customer without policies", customer, nil, "GET", "/customers/2001", http.StatusOK},
+		{"route not permitted", customer, authz.DefaultPolicies(), "GET", "/customers", http.StatusForbidden},
+		{"admin", admin, authz.DefaultPolicies(), "GET", "/customers/2001", http.StatusOK},
+		{"no claims", nil, authz.DefaultPolicies(), "GET", "/customers/2000", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			router := mux.NewRouter()
+			router.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if tt.claims != nil {
+						r = r.WithContext(NewContext(r.Context(), tt.claims))
+					}
+					next.ServeHTTP(w, r)
+				})
+			}, RequireRoutePermission(permissions, tt.policies))
+			router.Handle("/customers", ok).Methods("GET").Name("GetAllCustomers")
+			router.Handle("/customers/{customer_id:[0-9]+}", ok).Methods("GET").Name("GetCustomer")
+			router.Handle("/customers/{customer_id:[0-9]+}/account/{account_id:[0-9]+}", ok).Methods("POST").Name("NewTransaction")
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, nil))
+			if recorder.Code != tt.wantCode {
+				t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, recorder.Code, tt.wantCode, recorder.Body.String())
+			}
+		})
+	}
+}
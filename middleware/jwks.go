@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	JWKS_CACHE_DURATION       = time.Hour
+	JWKS_MIN_REFRESH_INTERVAL = time.Minute
+)
+
+type jwksKey struct {
+	alg       string
+	publicKey interface{}
+}
+
+/*
+JwksKeySource verifies tokens with the keys of a JSON Web Key Set. The keys
+are cached for JWKS_CACHE_DURATION and fetched again early when a token is
+signed with an unknown key id, which happens after a key rotation, but at
+most once per JWKS_MIN_REFRESH_INTERVAL.
+*/
+type JwksKeySource struct {
+	url       string
+	client    *http.Client
+	mu        sync.RWMutex
+	keys      map[string]jwksKey
+	fetchedOn time.Time
+	// serializes the fetches
+	fetchMu sync.Mutex
+}
+
+func (s *JwksKeySource) KeyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, fmt.Errorf("token without key id")
+	}
+	key, found, fresh := s.lookup(kid)
+	if !found || !fresh {
+		if err := s.refresh(!found); err != nil {
+			logger.Error("Error while fetching the JWKS: " + err.Error())
+		}
+		key, found, _ = s.lookup(kid)
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown key id: %v", kid)
+	}
+	if !keyMatchesMethod(key, token.Method) {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.publicKey, nil
+}
+
+func (s *JwksKeySource) lookup(kid string) (jwksKey, bool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, found := s.keys[kid]
+	return key, found, time.Since(s.fetchedOn) < JWKS_CACHE_DURATION
+}
+
+// refresh fetches the key set unless it is fresh, or with unknownKid was
+// fetched less than JWKS_MIN_REFRESH_INTERVAL ago.
+func (s *JwksKeySource) refresh(unknownKid bool) error {
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+
+	s.mu.RLock()
+	age := time.Since(s.fetchedOn)
+	s.mu.RUnlock()
+	if age < JWKS_MIN_REFRESH_INTERVAL || (!unknownKid && age < JWKS_CACHE_DURATION) {
+		return nil
+	}
+
+	keys, err := s.fetch()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// a failed fetch is not retried before the interval either
+	s.fetchedOn = time.Now()
+	if err != nil {
+		return err
+	}
+	s.keys = keys
+	return nil
+}
+
+func (s *JwksKeySource) fetch() (map[string]jwksKey, error) {
+	response, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", s.url, response.Status)
+	}
+	var jwks authz.JSONWebKeySet
+	if err = json.NewDecoder(response.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]jwksKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Skipping JWKS key %s: %s", jwk.Kid, err.Error()))
+			continue
+		}
+		keys[jwk.Kid] = jwksKey{jwk.Alg, publicKey}
+	}
+	return keys, nil
+}
+
+// keyMatchesMethod guards against tokens choosing an algorithm the key was
+// not meant for.
+func keyMatchesMethod(key jwksKey, method jwt.SigningMethod) bool {
+	if key.alg != "" && key.alg != method.Alg() {
+		return false
+	}
+	switch key.publicKey.(type) {
+	case *rsa.PublicKey:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		_, ok := method.(*jwt.SigningMethodECDSA)
+		return ok
+	case ed25519.PublicKey:
+		return method == authz.SigningMethodEdDSA
+	}
+	return false
+}
+
+func NewJwksKeySource(url string) *JwksKeySource {
+	return &JwksKeySource{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
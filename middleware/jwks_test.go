@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const testIssuer = "https://auth.example.com"
+
+func TestJwksKeyMatching(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublicKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaDer, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var jwks authz.JSONWebKeySet
+	for _, k := range []struct {
+		kid       string
+		alg       string
+		publicKey interface{}
+	}{
+		{"rsa", "RS256", &rsaKey.PublicKey},
+		{"rsa-any", "", &rsaKey.PublicKey},
+		{"ec", "ES256", &ecKey.PublicKey},
+		{"ed", "EdDSA", edPublicKey},
+	} {
+		jwk, _ := authz.NewJWK(k.kid, k.alg, k.publicKey)
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	encryptionKey, _ := authz.NewJWK("enc", "", &rsaKey.PublicKey)
+	encryptionKey.Use = "enc"
+	jwks.Keys = append(jwks.Keys, encryptionKey)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	defer server.Close()
+	validator := NewJwksValidator(server.URL, testIssuer)
+
+	tests := []struct {
+		name    string
+		kid     string
+		method  jwt.SigningMethod
+		key     interface{}
+		wantErr bool
+	}{
+		{"rsa", "rsa", jwt.SigningMethodRS256, rsaKey, false},
+		{"rsa other alg than published", "rsa", jwt.SigningMethodPS256, rsaKey, true},
+		{"rsa without alg", "rsa-any", jwt.SigningMethodPS256, rsaKey, false},
+		{"rsa without alg signed with ecdsa", "rsa-any", jwt.SigningMethodES256, ecKey, true},
+		{"rsa public key as hmac secret", "rsa-any", jwt.SigningMethodHS256, rsaDer, true},
+		{"ecdsa", "ec", jwt.SigningMethodES256, ecKey, false},
+		{"ecdsa with rsa alg", "ec", jwt.SigningMethodRS256, rsaKey, true},
+		{"ed25519", "ed", authz.SigningMethodEdDSA, edKey, false},
+		{"ed25519 with ecdsa alg", "ed", jwt.SigningMethodES256, ecKey, true},
+		{"encryption key", "enc", jwt.SigningMethodRS256, rsaKey, true},
+		{"unknown key id", "other", jwt.SigningMethodRS256, rsaKey, true},
+		{"no key id", "", jwt.SigningMethodRS256, rsaKey, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(tt.method, authz.AccessTokenClaims{
+				TokenType: authz.TokenTypeAccess,
+				Role:      authz.DefaultUserRole,
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    testIssuer,
+					ExpiresAt: time.Now().Add(time.Minute).Unix(),
+				},
+			})
+			if tt.kid != "" {
+				token.Header["kid"] = tt.kid
+			}
+			signed, err := token.SignedString(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = validator.ValidateAccessToken(signed); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAccessToken error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
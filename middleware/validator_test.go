@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestSharedKeyValidator(t *testing.T) {
+	secret := []byte("shared-test-secret")
+	validator := NewSharedKeyValidator(secret, testIssuer)
+	tests := []struct {
+		name       string
+		claims     jwt.MapClaims
+		key        []byte
+		wantUserId string
+		wantErr    bool
+	}{
+		{"string user id", jwt.MapClaims{"user_id": "42", "iss": testIssuer}, secret, "42", false},
+		{"numeric user id", jwt.MapClaims{"user_id": 42, "iss": testIssuer}, secret, "42", false},
+		{"no user id", jwt.MapClaims{"client_id": "backend", "iss": testIssuer}, secret, "", false},
+		{"fractional user id", jwt.MapClaims{"user_id": 4.2, "iss": testIssuer}, secret, "", true},
+		{"refresh token", jwt.MapClaims{"token_type": "refresh_token", "iss": testIssuer}, secret, "", true},
+		{"other issuer", jwt.MapClaims{"user_id": "42", "iss": "https://other.example.com"}, secret, "", true},
+		{"expired", jwt.MapClaims{"user_id": "42", "iss": testIssuer, "exp": time.Now().Add(-time.Minute).Unix()}, secret, "", true},
+		{"other secret", jwt.MapClaims{"user_id": "42", "iss": testIssuer}, []byte("other"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tt.claims).SignedString(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := validator.ValidateAccessToken(signed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateAccessToken error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && claims.UserId != tt.wantUserId {
+				t.Errorf("UserId = %q, want %q", claims.UserId, tt.wantUserId)
+			}
+		})
+	}
+}
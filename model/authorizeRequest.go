@@ -0,0 +1,32 @@
+package model
+
+// AuthorizeRequest is an OAuth authorization request, along with the
+// credentials once the user submitted the login form.
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientId            string
+	RedirectUri         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Username            string
+	Password            string
+	MfaToken            string
+	MfaCode             string
+	ClientIp            string
+	UserAgent           string
+}
+
+func (r AuthorizeRequest) AsLoginRequest() LoginRequest {
+	return LoginRequest{Username: r.Username, Password: r.Password, ClientId: r.ClientId, Nonce: r.Nonce, ClientIp: r.ClientIp, UserAgent: r.UserAgent}
+}
+
+// AuthorizeResponse is where the user agent is sent back to the client, with
+// either the code or the error in the query, or the MFA challenge token when
+// the user still has to enter the code of the second factor.
+type AuthorizeResponse struct {
+	RedirectUri string
+	MfaToken    string
+}
@@ -0,0 +1,11 @@
+package model
+
+import "github.com/harishkokcha91/sanyuktgolang/authz"
+
+// DecisionResponse is an authorization decision with the checks it was made
+// with, for debugging permissions and policies.
+type DecisionResponse struct {
+	IsAuthorized bool              `json:"isAuthorized"`
+	Message      string            `json:"message,omitempty"`
+	Trace        []authz.TraceStep `json:"trace"`
+}
@@ -0,0 +1,10 @@
+package model
+
+// IntrospectionRequest is the RFC 7662 introspection request along with the
+// credentials the calling client authenticated with.
+type IntrospectionRequest struct {
+	Token         string
+	TokenTypeHint string
+	ClientId      string
+	ClientSecret  string
+}
@@ -0,0 +1,18 @@
+package model
+
+// IntrospectionResponse is the RFC 7662 introspection response. Only Active is
+// set for tokens that are invalid, expired or revoked.
+type IntrospectionResponse struct {
+	Active     bool     `json:"active"`
+	Sub        string   `json:"sub,omitempty"`
+	Username   string   `json:"username,omitempty"`
+	Scope      string   `json:"scope,omitempty"`
+	Exp        int64    `json:"exp,omitempty"`
+	Iat        int64    `json:"iat,omitempty"`
+	Jti        string   `json:"jti,omitempty"`
+	Role       string   `json:"role,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+	CustomerId string   `json:"customer_id,omitempty"`
+	Accounts   []string `json:"accounts,omitempty"`
+	TokenType  string   `json:"token_type,omitempty"`
+}
@@ -0,0 +1,7 @@
+package model
+
+type KeyRotationResponse struct {
+	Kid        string `json:"kid"`
+	Alg        string `json:"alg"`
+	RetiredKid string `json:"retired_kid"`
+}
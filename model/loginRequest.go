@@ -5,4 +5,14 @@ type LoginRequest struct {
 	Password string `json:"password"`
 	Mobile   string `json:"user_mobile"`
 	Otp      string `json:"user_otp"`
+	// OpenID Connect client the ID token is issued to and its replay nonce
+	ClientId string `json:"client_id"`
+	Nonce    string `json:"nonce"`
+	// language of the OTP message, e.g. "hi-IN"
+	Locale string `json:"locale"`
+	// pending registration the OTP completes, see RegisterResponse
+	RegistrationId string `json:"registration_id"`
+	// caller details set by the handler for rate limiting and auditing
+	ClientIp  string `json:"-"`
+	UserAgent string `json:"-"`
 }
@@ -1,6 +1,14 @@
 package model
 
+// LoginResponse carries the tokens of a completed login. When the user has a
+// second factor the login is only complete once the mfa_token is verified
+// with it, until then no tokens are issued. MfaMethods lists the second
+// factors the user can answer with, "totp" and "passkey".
 type LoginResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token,omitempty"`
+	AccessToken  string   `json:"access_token,omitempty"`
+	RefreshToken string   `json:"refresh_token,omitempty"`
+	IdToken      string   `json:"id_token,omitempty"`
+	MfaRequired  bool     `json:"mfa_required,omitempty"`
+	MfaToken     string   `json:"mfa_token,omitempty"`
+	MfaMethods   []string `json:"mfa_methods,omitempty"`
 }
@@ -0,0 +1,33 @@
+package model
+
+import "encoding/json"
+
+// MfaVerifyRequest completes a login that returned mfa_required, with either
+// a code of the authenticator app, one of the recovery codes or the response
+// of navigator.credentials.get() for a passkey.
+type MfaVerifyRequest struct {
+	MfaToken     string          `json:"mfa_token"`
+	Code         string          `json:"code"`
+	RecoveryCode string          `json:"recovery_code"`
+	WebAuthn     json.RawMessage `json:"webauthn,omitempty"`
+	// caller details set by the handler for rate limiting and auditing
+	ClientIp  string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+// TotpConfirmRequest confirms an enrollment with the first code the
+// authenticator app shows.
+type TotpConfirmRequest struct {
+	Code string `json:"code"`
+}
+
+// WebAuthnLoginRequest completes a passwordless login with the response of
+// navigator.credentials.get().
+type WebAuthnLoginRequest struct {
+	Credential json.RawMessage `json:"credential"`
+	ClientId   string          `json:"client_id"`
+	Nonce      string          `json:"nonce"`
+	// caller details set by the handler for rate limiting and auditing
+	ClientIp  string `json:"-"`
+	UserAgent string `json:"-"`
+}
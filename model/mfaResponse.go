@@ -0,0 +1,22 @@
+package model
+
+// TotpEnrollmentResponse carries the secret to add to an authenticator app,
+// either typed in or scanned from a QR code of the otpauth:// URI.
+type TotpEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthUri string `json:"otpauth_uri"`
+}
+
+// TotpConfirmResponse carries the recovery codes, they are only ever shown
+// this once.
+type TotpConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// WebAuthnCredentialResponse describes a newly registered passkey.
+type WebAuthnCredentialResponse struct {
+	CredentialId    string `json:"credential_id"`
+	AttestationType string `json:"attestation_type"`
+	BackupEligible  bool   `json:"backup_eligible"`
+	BackupState     bool   `json:"backup_state"`
+}
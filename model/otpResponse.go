@@ -0,0 +1,8 @@
+package model
+
+// OtpResponse tells where the OTP was sent, the recipient is masked.
+type OtpResponse struct {
+	Channel   string `json:"channel"`
+	SentTo    string `json:"sent_to"`
+	ExpiresIn int64  `json:"expires_in"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+)
+
+// PolicyEvaluateRequest describes a request to /auth/verify by the claims
+// its token would carry, so permissions and policies can be tried out
+// without issuing a token.
+type PolicyEvaluateRequest struct {
+	Claims    authz.AccessTokenClaims `json:"claims"`
+	RouteName string                  `json:"route_name"`
+	Params    map[string]string       `json:"params"`
+	Method    string                  `json:"method"`
+	ClientIp  string                  `json:"client_ip"`
+	// evaluate as of this time instead of now, for time of day policies
+	Time *time.Time `json:"time,omitempty"`
+}
+
+func (r PolicyEvaluateRequest) AsVerifyRequest() VerifyRequest {
+	request := VerifyRequest{RouteName: r.RouteName, Params: r.Params, Method: r.Method, ClientIp: r.ClientIp}
+	if r.Time != nil {
+		request.Time = *r.Time
+	}
+	return request
+}
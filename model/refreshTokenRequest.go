@@ -2,7 +2,8 @@ package model
 
 import (
 	"errors"
-	"sanyuktgolang/domain"
+
+	"github.com/harishkokcha91/sanyuktgolang/domain"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -12,13 +13,11 @@ type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-func (r RefreshTokenRequest) IsAccessTokenValid() *jwt.ValidationError {
+func (r RefreshTokenRequest) IsAccessTokenValid(validator domain.TokenValidator) *jwt.ValidationError {
 
 	// 1. invalid token.
 	// 2. valid token but expired
-	_, err := jwt.Parse(r.AccessToken, func(token *jwt.Token) (interface{}, error) {
-		return []byte(domain.HMAC_SAMPLE_SECRET), nil
-	})
+	_, err := validator.ValidateAccessToken(r.AccessToken)
 	if err != nil {
 		var vErr *jwt.ValidationError
 		if errors.As(err, &vErr) {
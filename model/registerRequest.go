@@ -0,0 +1,44 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{2,63}$`)
+	mobilePattern   = regexp.MustCompile(`^\+?[0-9]{10,15}$`)
+)
+
+// RegisterRequest registers a username/password user. The mobile number is
+// optional; when given, the registration is only completed by verifying the
+// OTP sent to it, and the user of earlier OTP logins with the number is linked.
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Mobile   string `json:"user_mobile"`
+	ClientId string `json:"client_id"`
+	Nonce    string `json:"nonce"`
+	Locale   string `json:"locale"`
+	ClientIp string `json:"-"`
+}
+
+// Validate checks the format of the request, the password is checked against
+// the password policy by the service.
+func (r *RegisterRequest) Validate() *errs.AppError {
+	r.Username = strings.TrimSpace(r.Username)
+	r.Mobile = strings.TrimSpace(r.Mobile)
+	if !usernamePattern.MatchString(r.Username) {
+		return errs.NewValidationError("username must be 3 to 64 letters, digits, dots, dashes or underscores")
+	}
+	if r.Mobile != "" && !mobilePattern.MatchString(r.Mobile) {
+		return errs.NewValidationError("invalid mobile number")
+	}
+	return nil
+}
+
+func (r RegisterRequest) AsLoginRequest() LoginRequest {
+	return LoginRequest{Username: r.Username, Mobile: r.Mobile, ClientId: r.ClientId, Nonce: r.Nonce, Locale: r.Locale}
+}
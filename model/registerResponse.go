@@ -0,0 +1,17 @@
+package model
+
+const (
+	RegistrationComplete            = "registered"
+	RegistrationVerificationPending = "verification_pending"
+)
+
+// RegisterResponse carries the tokens of the new user or, when the mobile
+// number still has to be verified, the registration id to send to
+// /auth/verifyotp with the OTP sent to it.
+type RegisterResponse struct {
+	Status         string       `json:"status"`
+	UserId         string       `json:"user_id,omitempty"`
+	RegistrationId string       `json:"registration_id,omitempty"`
+	Otp            *OtpResponse `json:"otp,omitempty"`
+	*LoginResponse
+}
@@ -0,0 +1,7 @@
+package model
+
+// RevokeTokenRequest is the RFC 7009 revocation request.
+type RevokeTokenRequest struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint"`
+}
@@ -0,0 +1,19 @@
+package model
+
+// RoleRequest creates or replaces a role. Permissions and denies are route
+// names or patterns like "Get*" or "*", denies override the permissions of
+// every role the principal holds or inherits.
+type RoleRequest struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Denies      []string `json:"denies"`
+	Inherits    []string `json:"inherits"`
+}
+
+type RoleResponse struct {
+	Role        string   `json:"role"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Denies      []string `json:"denies"`
+	Inherits    []string `json:"inherits"`
+}
@@ -0,0 +1,13 @@
+package model
+
+// TokenRequest is a request to the OAuth token endpoint.
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectUri  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+	ClientId     string
+	ClientSecret string
+}
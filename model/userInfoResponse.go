@@ -0,0 +1,9 @@
+package model
+
+// UserInfoResponse holds the OpenID Connect standard claims of the user.
+type UserInfoResponse struct {
+	Sub                 string `json:"sub"`
+	PreferredUsername   string `json:"preferred_username,omitempty"`
+	PhoneNumber         string `json:"phone_number,omitempty"`
+	PhoneNumberVerified bool   `json:"phone_number_verified"`
+}
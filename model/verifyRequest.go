@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// VerifyRequest asks whether the bearer of Token may call the route
+// RouteName of the resource server with Params.
+type VerifyRequest struct {
+	Token     string
+	RouteName string
+	Params    map[string]string
+	// the HTTP method and client address of the request being authorized
+	Method   string
+	ClientIp string
+	// the time policies are evaluated at, now when zero
+	Time time.Time
+}
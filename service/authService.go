@@ -1,142 +1,667 @@
 package service
 
 import (
+	"database/sql"
 	"fmt"
-	"sanyuktgolang/auth"
-	"sanyuktgolang/domain"
-	"sanyuktgolang/errs"
-	"sanyuktgolang/logger"
-	"sanyuktgolang/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/domain"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+	"github.com/harishkokcha91/sanyuktgolang/model"
 
 	"github.com/dgrijalva/jwt-go"
+	"go.uber.org/zap"
 )
 
 type AuthService interface {
 	Login(model.LoginRequest) (*model.LoginResponse, *errs.AppError)
-	GenerateOtp(model.LoginRequest) (*model.LoginResponse, *errs.AppError)
+	GenerateOtp(model.LoginRequest) (*model.OtpResponse, *errs.AppError)
 	VerifyOtp(model.LoginRequest) (*model.LoginResponse, *errs.AppError)
-	Verify(urlParams map[string]string) *errs.AppError
+	Verify(request model.VerifyRequest) *errs.AppError
+	VerifyClaims(request model.VerifyRequest) (*authz.AccessTokenClaims, *errs.AppError)
+	Explain(request model.VerifyRequest) (*model.DecisionResponse, *errs.AppError)
 	Refresh(request model.RefreshTokenRequest) (*model.LoginResponse, *errs.AppError)
+	Revoke(request model.RevokeTokenRequest) *errs.AppError
+	Register(request model.RegisterRequest) (*model.RegisterResponse, *errs.AppError)
+	UnlockAccount(userId string) *errs.AppError
 }
 
 type DefaultAuthService struct {
 	repo            domain.AuthRepository
-	rolePermissions domain.RolePermissions
+	rolePermissions *authz.RolePermissions
+	policies        *authz.PolicySet
+	issuer          domain.TokenIssuer
+	validator       domain.TokenValidator
+	denylist        domain.TokenDenylist
+	hasher          domain.PasswordHasher
+	dummyHash       string
+	passwordPolicy  domain.PasswordPolicy
+	otpNotifier     domain.OtpNotifier
+	rateLimiter     domain.RateLimiter
+	lockouts        domain.AccountLockoutRepository
+	mfa             domain.MfaRepository
+	passkeys        domain.WebAuthnRelyingParty
+	clients         domain.ClientRepository
 }
 
 func (s DefaultAuthService) Refresh(request model.RefreshTokenRequest) (*model.LoginResponse, *errs.AppError) {
-	if vErr := request.IsAccessTokenValid(); vErr != nil {
+	if vErr := request.IsAccessTokenValid(s.validator); vErr != nil {
 		if vErr.Errors == jwt.ValidationErrorExpired {
 			// continue with the refresh token functionality
-			var appErr *errs.AppError
-			if appErr = s.repo.RefreshTokenExists(request.RefreshToken); appErr != nil {
-				return nil, appErr
-			}
-			// generate a access token from refresh token.
-			var accessToken string
-			if accessToken, appErr = domain.NewAccessTokenFromRefreshToken(request.RefreshToken); appErr != nil {
-				return nil, appErr
-			}
-			return &model.LoginResponse{AccessToken: accessToken}, nil
+			return s.RotateRefreshToken(request.RefreshToken, domain.ACCESS_TOKEN_DURATION, domain.REFRESH_TOKEN_DURATION)
 		}
 		return nil, errs.NewAuthenticationError("invalid token")
 	}
 	return nil, errs.NewAuthenticationError("cannot generate a new access token until the current one expires")
 }
 
+/*
+RotateRefreshToken consumes the presented refresh token and issues a new
+token pair in the same family. A token that was already rotated is being
+replayed, so it has leaked: the whole family is revoked, which logs out the
+legitimate client as well as whoever holds the copy. The new refresh token
+lives for refreshTTL, but the family ends REFRESH_TOKEN_MAX_DURATION after
+the login that started it, however often it was rotated.
+*/
+func (s DefaultAuthService) RotateRefreshToken(refreshToken string, accessTTL time.Duration, refreshTTL time.Duration) (*model.LoginResponse, *errs.AppError) {
+	claims, err := s.validator.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, errs.NewAuthenticationError("invalid or expired refresh token")
+	}
+
+	record, appErr := s.repo.FindRefreshToken(refreshToken)
+	if appErr != nil {
+		return nil, appErr
+	}
+	switch record.Status {
+	case domain.RefreshTokenRotated:
+		return nil, s.refreshTokenReused(*record, claims.UserId)
+	case domain.RefreshTokenRevoked:
+		return nil, errs.NewAuthenticationError("refresh token revoked")
+	}
+	familyId := record.FamilyId.String
+	if !record.FamilyId.Valid {
+		familyId = domain.NewRandomId()
+	}
+
+	// tokens issued before the login time was recorded start their family now
+	familyStart := time.Now()
+	if claims.AuthTime > 0 || claims.IssuedAt > 0 {
+		familyStart = claims.FamilyStart()
+	}
+	if !time.Now().Before(familyStart.Add(domain.REFRESH_TOKEN_MAX_DURATION)) {
+		return nil, errs.NewAuthenticationError("invalid or expired refresh token")
+	}
+	accessTokenClaims := claims.AccessTokenClaims()
+	accessTokenClaims.ExpiresAt = time.Now().Add(accessTTL).Unix()
+	var accessToken, nextRefreshToken string
+	if accessToken, appErr = s.issuer.NewAccessToken(accessTokenClaims); appErr != nil {
+		return nil, appErr
+	}
+	if nextRefreshToken, appErr = s.issuer.NewRefreshToken(accessTokenClaims, familyStart, refreshTTL); appErr != nil {
+		return nil, appErr
+	}
+	if appErr = s.repo.RotateRefreshToken(refreshToken, nextRefreshToken, familyId); appErr != nil {
+		if appErr.Code == http.StatusConflict {
+			// a concurrent refresh rotated the token first, into the family it chose
+			if current, findErr := s.repo.FindRefreshToken(refreshToken); findErr == nil {
+				record = current
+			}
+			return nil, s.refreshTokenReused(*record, claims.UserId)
+		}
+		return nil, appErr
+	}
+	return &model.LoginResponse{AccessToken: accessToken, RefreshToken: nextRefreshToken}, nil
+}
+
+// refreshTokenReused revokes the family of a replayed token or, when it has
+// none, every refresh token of its owner.
+func (s DefaultAuthService) refreshTokenReused(record domain.RefreshTokenRecord, userId string) *errs.AppError {
+	logger.Warn("Security event: refresh token reuse detected, revoking token family",
+		zap.String("event", "refresh_token_reuse"),
+		zap.String("family_id", record.FamilyId.String),
+		zap.String("owner", record.Owner.String),
+		zap.String("user_id", userId))
+	var appErr *errs.AppError
+	switch {
+	case record.FamilyId.Valid:
+		appErr = s.repo.RevokeRefreshTokenFamily(record.FamilyId.String)
+	case record.Owner.Valid:
+		appErr = s.repo.RevokeRefreshTokensOf(record.Owner.String)
+	default:
+		appErr = s.repo.RevokeRefreshToken(record.RefreshToken)
+	}
+	if appErr != nil {
+		return appErr
+	}
+	return errs.NewAuthenticationError("refresh token reuse detected")
+}
+
 func (s DefaultAuthService) Login(req model.LoginRequest) (*model.LoginResponse, *errs.AppError) {
 	var appErr *errs.AppError
 	var login *domain.Login
 
-	if login, appErr = s.repo.FindBy(req.Username, req.Password); appErr != nil {
+	if appErr = s.checkIdTokenClient(req.ClientId); appErr != nil {
+		return nil, appErr
+	}
+	if login, appErr = s.Authenticate(req); appErr != nil {
+		return nil, appErr
+	}
+	return s.completeLogin(login, req)
+}
+
+// completeLogin issues the tokens of a user that proved the first factor, or
+// the MFA challenge when the user has a second factor.
+func (s DefaultAuthService) completeLogin(login *domain.Login, req model.LoginRequest) (*model.LoginResponse, *errs.AppError) {
+	mfaToken, mfaMethods, appErr := s.ChallengeSecondFactor(login, req)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if mfaToken != "" {
+		return &model.LoginResponse{MfaRequired: true, MfaToken: mfaToken, MfaMethods: mfaMethods}, nil
+	}
+
+	var response *model.LoginResponse
+	if response, appErr = s.IssueTokens(login.ClaimsForAccessToken(), login.TokenOwner(), domain.NewRandomId(), domain.REFRESH_TOKEN_DURATION); appErr != nil {
+		return nil, appErr
+	}
+	return s.AddIdToken(response, login.ClaimsForIdToken(), req)
+}
+
+/*
+Authenticate checks the username and password of a user logging in, either
+directly or through the OAuth authorization endpoint. Attempts are rate
+limited per client IP and per username to slow down guessing, and accounts
+with too many consecutive failures are refused before the password is even
+checked. Unknown usernames and locked accounts are verified against a dummy
+hash so they take as long as, and fail like, wrong passwords. A password
+stored in plaintext or with an outdated hash is rehashed once it verifies;
+failing to store the new hash does not fail the login. The failed logins of
+the account are only reset once the login completes, see
+ChallengeSecondFactor.
+*/
+func (s DefaultAuthService) Authenticate(req model.LoginRequest) (*domain.Login, *errs.AppError) {
+	if appErr := s.rateLimiter.Allow(domain.RateLimitLoginIp, req.ClientIp); appErr != nil {
+		return nil, appErr
+	}
+	if appErr := s.rateLimiter.Allow(domain.RateLimitLoginUsername, req.Username); appErr != nil {
+		return nil, appErr
+	}
+
+	login, appErr := s.repo.FindByUsername(req.Username)
+	if appErr != nil {
+		if appErr.Code != http.StatusNotFound {
+			return nil, appErr
+		}
+		s.hasher.Verify(req.Password, s.dummyHash)
+		s.recordLoginFailure(domain.LoginFailure{Account: req.Username, Method: domain.LoginMethodPassword, Reason: "unknown_user"}, req)
+		return nil, errs.NewAuthenticationError("invalid credentials")
+	}
+	if appErr = s.CheckNotLockedOut(login.TokenOwner()); appErr != nil {
+		if appErr.Code == http.StatusUnauthorized {
+			s.hasher.Verify(req.Password, s.dummyHash)
+			s.recordLoginFailure(domain.LoginFailure{Account: req.Username, Method: domain.LoginMethodPassword, Reason: "account_locked"}, req)
+		}
 		return nil, appErr
 	}
 
-	claims := login.ClaimsForAccessToken()
-	authToken := domain.NewAuthToken(claims)
+	ok, needsRehash := s.hasher.Verify(req.Password, login.PasswordHash)
+	if !ok {
+		failure := domain.LoginFailure{
+			Owner:   sql.NullString{String: login.TokenOwner(), Valid: true},
+			Account: req.Username,
+			Method:  domain.LoginMethodPassword,
+			Reason:  "invalid_password",
+		}
+		s.recordLoginFailure(failure, req)
+		return nil, errs.NewAuthenticationError("invalid credentials")
+	}
+	if needsRehash {
+		if hash, err := s.hasher.Hash(req.Password); err != nil {
+			logger.Error("Error while rehashing password: " + err.Error())
+		} else {
+			s.repo.UpdatePasswordHash(login.UserId, hash)
+		}
+	}
+	return login, nil
+}
 
+// CheckNotLockedOut refuses locked accounts with the error of wrong
+// credentials, so the lockout does not tell which accounts exist.
+func (s DefaultAuthService) CheckNotLockedOut(owner string) *errs.AppError {
+	lockout, appErr := s.lockouts.FindLockout(owner)
+	if appErr != nil {
+		return appErr
+	}
+	if lockout.RetryAfter(time.Now()) > 0 {
+		return errs.NewAuthenticationError("invalid credentials")
+	}
+	return nil
+}
+
+// recordLoginFailure only logs errors, the login failed anyway.
+func (s DefaultAuthService) recordLoginFailure(failure domain.LoginFailure, req model.LoginRequest) {
+	failure.ClientIp = req.ClientIp
+	failure.UserAgent = req.UserAgent
+	s.lockouts.RecordFailure(failure)
+}
+
+// IssueTokens creates the access and refresh token pair for an authenticated
+// user and registers the refresh token in the store as the first of a new
+// family of owner.
+func (s DefaultAuthService) IssueTokens(claims authz.AccessTokenClaims, owner string, familyId string, refreshTTL time.Duration) (*model.LoginResponse, *errs.AppError) {
+	var appErr *errs.AppError
 	var accessToken, refreshToken string
-	if accessToken, appErr = authToken.NewAccessToken(); appErr != nil {
+	if accessToken, appErr = s.issuer.NewAccessToken(claims); appErr != nil {
 		return nil, appErr
 	}
 
-	if refreshToken, appErr = s.repo.GenerateAndSaveRefreshTokenToStore(authToken); appErr != nil {
+	if refreshToken, appErr = s.issuer.NewRefreshToken(claims, time.Now(), refreshTTL); appErr != nil {
+		return nil, appErr
+	}
+
+	if appErr = s.repo.SaveRefreshTokenToStore(refreshToken, familyId, owner); appErr != nil {
 		return nil, appErr
 	}
 
 	return &model.LoginResponse{AccessToken: accessToken, RefreshToken: refreshToken}, nil
 }
 
-func (s DefaultAuthService) GenerateOtp(req model.LoginRequest) (*model.LoginResponse, *errs.AppError) {
-	var appErr *errs.AppError
-	var login *domain.Users
+// AddIdToken adds the OpenID Connect ID token for the client the login was
+// made through to the response.
+func (s DefaultAuthService) AddIdToken(response *model.LoginResponse, claims domain.IdTokenClaims, req model.LoginRequest) (*model.LoginResponse, *errs.AppError) {
+	if appErr := s.checkIdTokenClient(req.ClientId); appErr != nil {
+		return nil, appErr
+	}
+	claims.Audience = req.ClientId
+	claims.Nonce = req.Nonce
+	claims.AuthTime = time.Now().Unix()
+	idToken, appErr := s.issuer.NewIdToken(claims)
+	if appErr != nil {
+		return nil, appErr
+	}
+	response.IdToken = idToken
+	return response, nil
+}
+
+// checkIdTokenClient only lets ID tokens be addressed to registered clients,
+// without a client they are addressed to the issuer itself.
+func (s DefaultAuthService) checkIdTokenClient(clientId string) *errs.AppError {
+	if clientId == "" {
+		return nil
+	}
+	if _, appErr := s.clients.FindClient(clientId); appErr != nil {
+		if appErr.Code == http.StatusUnauthorized {
+			return errs.NewValidationError("unknown client_id")
+		}
+		return appErr
+	}
+	return nil
+}
+
+/*
+Register creates a username/password user with the default role. A user
+registering with a mobile number gets no login and no tokens yet, whether or
+not the number was verified before: an OTP is sent to it, within the OTP
+rate limits, and verifying it through /auth/verifyotp with the registration id
+creates the login. Numbers already linked to a login are refused.
+*/
+func (s DefaultAuthService) Register(req model.RegisterRequest) (*model.RegisterResponse, *errs.AppError) {
+	if appErr := req.Validate(); appErr != nil {
+		return nil, appErr
+	}
+	if appErr := s.checkIdTokenClient(req.ClientId); appErr != nil {
+		return nil, appErr
+	}
+	if appErr := s.passwordPolicy.Check(req.Username, req.Password); appErr != nil {
+		return nil, appErr
+	}
+	if _, appErr := s.repo.FindByUsername(req.Username); appErr == nil {
+		return nil, errs.NewConflictError("username already taken")
+	} else if appErr.Code != http.StatusNotFound {
+		return nil, appErr
+	}
+	if req.Mobile != "" {
+		if appErr := s.allowOtp(req.Mobile, req.ClientIp); appErr != nil {
+			return nil, appErr
+		}
+		if appErr := s.checkMobileNotRegistered(req.Mobile); appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	passwordHash, err := s.hasher.Hash(req.Password)
+	if err != nil {
+		logger.Error("Error while hashing password: " + err.Error())
+		return nil, errs.NewUnexpectedError("unexpected error")
+	}
+	registration := domain.Registration{
+		Username:     req.Username,
+		PasswordHash: passwordHash,
+		Mobile:       sql.NullString{String: req.Mobile, Valid: req.Mobile != ""},
+		Role:         authz.DefaultUserRole,
+	}
+	if registration.Mobile.Valid {
+		registrationId := domain.NewRandomId()
+		if appErr := s.repo.SavePendingRegistration(registrationId, registration); appErr != nil {
+			return nil, appErr
+		}
+		user, appErr := s.repo.FindByMobile(req.Mobile)
+		if appErr != nil {
+			return nil, appErr
+		}
+		otp, appErr := s.sendOtp(*user, req.Locale)
+		if appErr != nil {
+			return nil, appErr
+		}
+		return &model.RegisterResponse{Status: model.RegistrationVerificationPending, RegistrationId: registrationId, Otp: otp}, nil
+	}
 
-	if login, appErr = s.repo.FindByMobile(req.Mobile); appErr != nil {
+	login, appErr := s.repo.Register(registration)
+	if appErr != nil {
+		return nil, appErr
+	}
+	response, appErr := s.completeLogin(login, req.AsLoginRequest())
+	if appErr != nil {
 		return nil, appErr
 	}
-	fmt.Println(login)
-	return &model.LoginResponse{AccessToken: "accessToken", RefreshToken: "refreshToken"}, nil
+	return &model.RegisterResponse{Status: model.RegistrationComplete, UserId: strconv.FormatInt(login.UserId, 10), LoginResponse: response}, nil
 }
 
+func (s DefaultAuthService) GenerateOtp(req model.LoginRequest) (*model.OtpResponse, *errs.AppError) {
+	if req.Mobile == "" {
+		return nil, errs.NewValidationError("missing mobile number")
+	}
+	// checked before the user is looked up, as unknown numbers create users
+	if appErr := s.allowOtp(req.Mobile, req.ClientIp); appErr != nil {
+		return nil, appErr
+	}
+	user, appErr := s.repo.FindByMobile(req.Mobile)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return s.sendOtp(*user, req.Locale)
+}
+
+// allowOtp applies the rate limits of OTPs sent to the mobile number, both
+// by /auth/generateotp and by registrations with a mobile number.
+func (s DefaultAuthService) allowOtp(mobile string, clientIp string) *errs.AppError {
+	if appErr := s.rateLimiter.Allow(domain.RateLimitOtpIp, clientIp); appErr != nil {
+		return appErr
+	}
+	if appErr := s.rateLimiter.Allow(domain.RateLimitOtpResend, mobile); appErr != nil {
+		return appErr
+	}
+	return s.rateLimiter.Allow(domain.RateLimitOtpMobile, mobile)
+}
+
+// checkMobileNotRegistered refuses a mobile number already linked to a login,
+// a number can only be linked to a single login.
+func (s DefaultAuthService) checkMobileNotRegistered(mobile string) *errs.AppError {
+	userId, appErr := s.repo.FindUserIdByMobile(mobile)
+	if appErr != nil {
+		if appErr.Code == http.StatusNotFound {
+			return nil
+		}
+		return appErr
+	}
+	if _, appErr = s.repo.FindLoginBySanyuktUserId(userId); appErr == nil {
+		return errs.NewConflictError("mobile number already registered")
+	} else if appErr.Code != http.StatusNotFound {
+		return appErr
+	}
+	return nil
+}
+
+// sendOtp issues a new code to the user, replacing the previous one, and
+// sends it over the configured channel.
+func (s DefaultAuthService) sendOtp(user domain.Users, locale string) (*model.OtpResponse, *errs.AppError) {
+	code := domain.NewOtpCode()
+	if appErr := s.repo.SaveOtp(user.Mobile, user.Id, code); appErr != nil {
+		return nil, appErr
+	}
+	channel, sentTo, err := s.otpNotifier.Notify(user, code, locale)
+	if err != nil {
+		logger.Error("Error while sending otp: " + err.Error())
+		return nil, errs.NewUnexpectedError("unable to send otp")
+	}
+	return &model.OtpResponse{Channel: channel, SentTo: sentTo, ExpiresIn: int64(s.otpNotifier.TTL().Seconds())}, nil
+}
+
+/*
+VerifyOtp logs in the user the OTP was sent to or, with a registration id,
+completes that registration and logs in its new login. Users whose number is
+linked to a password login log in as that login, asked for its second factor
+like a password login. Wrong codes count towards the lockout of the account,
+like wrong passwords.
+*/
 func (s DefaultAuthService) VerifyOtp(req model.LoginRequest) (*model.LoginResponse, *errs.AppError) {
-	var appErr *errs.AppError
-	var login *domain.Users
+	if appErr := s.checkIdTokenClient(req.ClientId); appErr != nil {
+		return nil, appErr
+	}
+	userId, appErr := s.repo.FindUserIdByMobile(req.Mobile)
+	if appErr != nil {
+		if appErr.Code != http.StatusNotFound {
+			return nil, appErr
+		}
+		s.recordLoginFailure(domain.LoginFailure{Account: req.Mobile, Method: domain.LoginMethodOtp, Reason: "unknown_user"}, req)
+		return nil, domain.NewOtpInvalidError()
+	}
+	owner := domain.Users{Id: userId}.TokenOwner()
+	if appErr = s.CheckNotLockedOut(owner); appErr != nil {
+		if appErr.Code != http.StatusUnauthorized {
+			return nil, appErr
+		}
+		s.recordLoginFailure(domain.LoginFailure{Account: req.Mobile, Method: domain.LoginMethodOtp, Reason: "account_locked"}, req)
+		return nil, domain.NewOtpInvalidError()
+	}
+
+	user, appErr := s.repo.VerifyOtp(req.Mobile, req.Otp)
+	if appErr != nil {
+		if appErr.ErrorCode == domain.OtpErrorInvalid || appErr.ErrorCode == domain.OtpErrorLocked {
+			failure := domain.LoginFailure{
+				Owner:   sql.NullString{String: owner, Valid: true},
+				Account: req.Mobile,
+				Method:  domain.LoginMethodOtp,
+				Reason:  appErr.ErrorCode,
+			}
+			s.recordLoginFailure(failure, req)
+		}
+		return nil, appErr
+	}
+
+	var linked *domain.Login
+	if req.RegistrationId != "" {
+		linked, appErr = s.repo.CompleteRegistration(req.RegistrationId, req.Mobile)
+	} else if linked, appErr = s.repo.FindLoginBySanyuktUserId(user.Id); appErr != nil && appErr.Code == http.StatusNotFound {
+		linked, appErr = nil, nil
+	}
+	if appErr != nil {
+		return nil, appErr
+	}
+	if linked != nil {
+		if appErr = s.CheckNotLockedOut(linked.TokenOwner()); appErr != nil {
+			return nil, appErr
+		}
+		response, appErr := s.completeLogin(linked, req)
+		if appErr == nil && !response.MfaRequired {
+			s.lockouts.Reset(owner)
+		}
+		return response, appErr
+	}
+	s.lockouts.Reset(owner)
 
-	if login, appErr = s.repo.VerifyOtp(req.Mobile, req.Otp); appErr != nil {
+	var response *model.LoginResponse
+	if response, appErr = s.IssueTokens(user.ClaimsForAccessToken(), user.TokenOwner(), domain.NewRandomId(), domain.REFRESH_TOKEN_DURATION); appErr != nil {
 		return nil, appErr
 	}
-	fmt.Println(login)
+	return s.AddIdToken(response, user.ClaimsForIdToken(true), req)
+}
 
-	token, err := auth.CreateToken(uint32(login.Id))
+// UnlockAccount lets an admin clear the failed logins of a password login
+// before the lockout ends.
+func (s DefaultAuthService) UnlockAccount(userId string) *errs.AppError {
+	id, err := strconv.ParseInt(userId, 10, 64)
 	if err != nil {
-		return nil, errs.NewAuthenticationError("not able to create token")
+		return errs.NewValidationError("invalid user id")
+	}
+	login, appErr := s.repo.FindLoginById(id)
+	if appErr != nil {
+		return appErr
+	}
+	if appErr := s.lockouts.Reset(login.TokenOwner()); appErr != nil {
+		return appErr
 	}
-	return &model.LoginResponse{AccessToken: token, RefreshToken: token}, nil
+	logger.Info("Account unlocked", zap.String("event", "account_unlocked"), zap.String("user_id", userId))
+	return nil
 }
 
-func (s DefaultAuthService) Verify(urlParams map[string]string) *errs.AppError {
+/*
+Verify checks the token, its role permissions for the route and then the
+attribute based policies, e.g. that customers only access their own
+accounts.
+*/
+func (s DefaultAuthService) Verify(request model.VerifyRequest) *errs.AppError {
+	_, appErr := s.verify(request, nil)
+	return appErr
+}
+
+// VerifyClaims makes the same decision as Verify and returns the claims of the
+// token when the request is authorized, for proxies passing them upstream.
+func (s DefaultAuthService) VerifyClaims(request model.VerifyRequest) (*authz.AccessTokenClaims, *errs.AppError) {
+	return s.verify(request, nil)
+}
+
+func (s DefaultAuthService) verify(request model.VerifyRequest, trace *authz.DecisionTrace) (*authz.AccessTokenClaims, *errs.AppError) {
 	// convert the string token to JWT struct
-	if jwtToken, err := jwtTokenFromString(urlParams["token"]); err != nil {
-		return errs.NewAuthorizationError(err.Error())
+	/*
+	   Checking the validity of the token, this verifies the expiry
+	   time, the signature and the type of the token
+	*/
+	if claims, err := jwtTokenFromString(request.Token, s.validator); err != nil {
+		trace.Add("token", "", authz.TraceFail, err.Error())
+		return nil, errs.NewAuthorizationError(err.Error())
 	} else {
-		/*
-		   Checking the validity of the token, this verifies the expiry
-		   time and the signature of the token
-		*/
-		if jwtToken.Valid {
-			// type cast the token claims to jwt.MapClaims
-			claims := jwtToken.Claims.(*domain.AccessTokenClaims)
-			/* if Role if user then check if the account_id and customer_id
-			   coming in the URL belongs to the same token
-			*/
-			if claims.IsUserRole() {
-				if !claims.IsRequestVerifiedWithTokenClaims(urlParams) {
-					return errs.NewAuthorizationError("request not verified with the token claims")
-				}
-			}
-			// verify of the role is authorized to use the route
-			isAuthorized := s.rolePermissions.IsAuthorizedFor(claims.Role, urlParams["routeName"])
-			if !isAuthorized {
-				return errs.NewAuthorizationError(fmt.Sprintf("%s role is not authorized", claims.Role))
-			}
-			return nil
-		} else {
-			return errs.NewAuthorizationError("Invalid token")
+		if appErr := s.CheckNotRevoked(claims); appErr != nil {
+			trace.Add("token", claims.Subject, authz.TraceFail, appErr.Message)
+			return nil, appErr
+		}
+		trace.Add("token", claims.Subject, authz.TracePass, "signature, expiry and revocation checked")
+		if appErr := s.Authorize(claims, request, trace); appErr != nil {
+			return nil, appErr
 		}
+		return claims, nil
+	}
+}
+
+// Authorize checks the role permissions and the policies for the claims of a
+// verified token.
+func (s DefaultAuthService) Authorize(claims *authz.AccessTokenClaims, request model.VerifyRequest, trace *authz.DecisionTrace) *errs.AppError {
+	// verify of the role is authorized to use the route
+	isAuthorized := s.rolePermissions.Explain(claims.AllRoles(), request.RouteName, trace)
+	if !isAuthorized {
+		return errs.NewAuthorizationError(fmt.Sprintf("%s role is not authorized", strings.Join(claims.AllRoles(), ", ")))
+	}
+	now := request.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	decision := s.policies.Explain(authz.AccessRequest{
+		Claims:    claims,
+		Roles:     s.rolePermissions.EffectiveRoles(claims.AllRoles()),
+		RouteName: request.RouteName,
+		Params:    request.Params,
+		Method:    request.Method,
+		ClientIp:  request.ClientIp,
+		Time:      now,
+	}, trace)
+	if !decision.Allowed {
+		return errs.NewAuthorizationError(decision.Message)
 	}
+	return nil
 }
 
-func jwtTokenFromString(tokenString string) (*jwt.Token, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &domain.AccessTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(domain.HMAC_SAMPLE_SECRET), nil
-	})
+/*
+Revoke implements RFC 7009. Access tokens are denylisted until they expire,
+refresh tokens are revoked in the store together with their family. The hint
+only decides which token type is tried first, and tokens that are invalid or
+already expired need no revocation, so they are not an error either.
+*/
+func (s DefaultAuthService) Revoke(request model.RevokeTokenRequest) *errs.AppError {
+	if request.Token == "" {
+		return errs.NewValidationError("missing token")
+	}
+	if request.TokenTypeHint == authz.TokenTypeRefresh {
+		if revoked, appErr := s.revokeRefreshToken(request.Token); revoked || appErr != nil {
+			return appErr
+		}
+		_, appErr := s.revokeAccessToken(request.Token)
+		return appErr
+	}
+	if revoked, appErr := s.revokeAccessToken(request.Token); revoked || appErr != nil {
+		return appErr
+	}
+	_, appErr := s.revokeRefreshToken(request.Token)
+	return appErr
+}
+
+func (s DefaultAuthService) revokeAccessToken(token string) (bool, *errs.AppError) {
+	claims, err := s.validator.ValidateAccessToken(token)
+	if err != nil || claims.Id == "" {
+		return false, nil
+	}
+	return true, s.denylist.Add(claims.Id, time.Unix(claims.ExpiresAt, 0))
+}
+
+func (s DefaultAuthService) revokeRefreshToken(token string) (bool, *errs.AppError) {
+	if _, err := s.validator.ValidateRefreshToken(token); err != nil {
+		return false, nil
+	}
+	record, appErr := s.repo.FindRefreshToken(token)
+	if appErr != nil {
+		if appErr.Code == http.StatusUnauthorized {
+			return false, nil
+		}
+		return false, appErr
+	}
+	if record.FamilyId.Valid {
+		return true, s.repo.RevokeRefreshTokenFamily(record.FamilyId.String)
+	}
+	return true, s.repo.RevokeRefreshToken(token)
+}
+
+func (s DefaultAuthService) CheckNotRevoked(claims *authz.AccessTokenClaims) *errs.AppError {
+	if claims.Id == "" {
+		return nil
+	}
+	revoked, appErr := s.denylist.Contains(claims.Id)
+	if appErr != nil {
+		return appErr
+	}
+	if revoked {
+		return errs.NewAuthorizationError("token revoked")
+	}
+	return nil
+}
+
+func jwtTokenFromString(tokenString string, validator domain.TokenValidator) (*authz.AccessTokenClaims, error) {
+	claims, err := validator.ValidateAccessToken(tokenString)
 	if err != nil {
 		logger.Error("Error while parsing token: " + err.Error())
 		return nil, err
 	}
-	return token, nil
+	return claims, nil
 }
 
-func NewLoginService(repo domain.AuthRepository, permissions domain.RolePermissions) DefaultAuthService {
-	return DefaultAuthService{repo, permissions}
+func NewLoginService(repo domain.AuthRepository, permissions *authz.RolePermissions, policies *authz.PolicySet, issuer domain.TokenIssuer, validator domain.TokenValidator, denylist domain.TokenDenylist, hasher domain.PasswordHasher, otpNotifier domain.OtpNotifier, rateLimiter domain.RateLimiter, lockouts domain.AccountLockoutRepository, mfa domain.MfaRepository, passkeys domain.WebAuthnRelyingParty, clients domain.ClientRepository) DefaultAuthService {
+	dummyHash, err := hasher.Hash(domain.NewRandomId())
+	if err != nil {
+		panic(err)
+	}
+	return DefaultAuthService{repo, permissions, policies, issuer, validator, denylist, hasher, dummyHash, domain.NewPasswordPolicy(), otpNotifier, rateLimiter, lockouts, mfa, passkeys, clients}
 }
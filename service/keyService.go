@@ -0,0 +1,132 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/domain"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+)
+
+type KeyService interface {
+	Jwks() authz.JSONWebKeySet
+	Rotate() (*model.KeyRotationResponse, *errs.AppError)
+}
+
+type DefaultKeyService struct {
+	repo       domain.KeyRepository
+	keys       *domain.KeyRing
+	maxRetired int
+}
+
+// Jwks returns the public keys tokens are verified with, the active one first.
+// Symmetric keys are never published.
+func (s DefaultKeyService) Jwks() authz.JSONWebKeySet {
+	return s.keys.Jwks()
+}
+
+// Rotate generates a new active key with the algorithm of the current one.
+// The current key is kept for verification as long as tokens it signed can be
+// valid, and after that while it is among the newest maxRetired retired keys.
+func (s DefaultKeyService) Rotate() (*model.KeyRotationResponse, *errs.AppError) {
+	active := s.keys.Signer()
+	next, err := domain.GenerateSigner(active.Method().Alg())
+	if err != nil {
+		logger.Error("Error while generating signing key: " + err.Error())
+		return nil, errs.NewUnexpectedError("cannot generate signing key")
+	}
+	key, err := domain.NewSigningKey(next)
+	if err != nil {
+		logger.Error("Error while encoding signing key: " + err.Error())
+		return nil, errs.NewUnexpectedError("cannot generate signing key")
+	}
+	if appErr := s.repo.RotateSigningKey(active.Kid(), key, s.maxRetired); appErr != nil {
+		return nil, appErr
+	}
+	if appErr := s.Reload(); appErr != nil {
+		return nil, appErr
+	}
+	logger.Info(fmt.Sprintf("Rotated signing key %s to %s", active.Kid(), key.Kid))
+	return &model.KeyRotationResponse{Kid: key.Kid, Alg: key.Alg, RetiredKid: active.Kid()}, nil
+}
+
+// Reload refreshes the key ring from the store, picking up rotations made by
+// other instances.
+func (s DefaultKeyService) Reload() *errs.AppError {
+	keys, appErr := s.repo.FindSigningKeys()
+	if appErr != nil {
+		return appErr
+	}
+	if err := s.keys.Load(keys); err != nil {
+		logger.Error("Error while loading signing keys: " + err.Error())
+		return errs.NewUnexpectedError("cannot load signing keys")
+	}
+	return nil
+}
+
+// ScheduleReload reloads the key ring every interval, picking up keys rotated
+// by other instances, through the API or on schedule.
+func (s DefaultKeyService) ScheduleReload(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if appErr := s.Reload(); appErr != nil {
+				logger.Error("Error while reloading signing keys: " + appErr.Message)
+			}
+		}
+	}()
+}
+
+/*
+ScheduleRotation checks every checkInterval whether the active key is older
+than rotationInterval and rotates it then. Losing the race against another
+instance is not an error, the winner's key is picked up by the reload.
+*/
+func (s DefaultKeyService) ScheduleRotation(rotationInterval time.Duration, checkInterval time.Duration) {
+	ticker := time.NewTicker(checkInterval)
+	go func() {
+		for range ticker.C {
+			if time.Since(s.keys.ActiveSince()) < rotationInterval {
+				continue
+			}
+			if _, appErr := s.Rotate(); appErr != nil && appErr.Code == http.StatusConflict {
+				s.Reload()
+			}
+		}
+	}()
+}
+
+/*
+NewKeyService loads the key ring from the store. On first start the store is
+empty and the ring's configured active key is persisted instead.
+*/
+func NewKeyService(repo domain.KeyRepository, keys *domain.KeyRing, maxRetired int) (DefaultKeyService, *errs.AppError) {
+	s := DefaultKeyService{repo, keys, maxRetired}
+	if maxRetired < 0 {
+		return s, errs.NewValidationError("the number of retired keys kept must not be negative")
+	}
+	stored, appErr := repo.FindSigningKeys()
+	if appErr != nil {
+		return s, appErr
+	}
+	if len(stored) == 0 {
+		key, err := domain.NewSigningKey(keys.Signer())
+		if err != nil {
+			logger.Error("Error while encoding signing key: " + err.Error())
+			return s, errs.NewUnexpectedError("cannot store signing key")
+		}
+		if appErr = repo.SaveSigningKey(key); appErr != nil {
+			return s, appErr
+		}
+		return s, nil
+	}
+	return s, s.Reload()
+}
+
+func (s DefaultKeyService) KeyRing() *domain.KeyRing {
+	return s.keys
+}
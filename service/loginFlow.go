@@ -0,0 +1,30 @@
+package service
+
+import (
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/domain"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+)
+
+/*
+LoginFlow are the steps of a login the OAuth, MFA, passkey and policy
+services build their own flows from, so the rate limits, lockouts and second
+factor rules are the same whichever way a user logs in. DefaultAuthService
+implements it.
+*/
+type LoginFlow interface {
+	Authenticate(req model.LoginRequest) (*domain.Login, *errs.AppError)
+	CheckNotLockedOut(owner string) *errs.AppError
+	ChallengeSecondFactor(login *domain.Login, req model.LoginRequest) (string, []string, *errs.AppError)
+	MfaChallenge(mfaToken string) (*domain.Login, *domain.MfaChallengeClaims, *errs.AppError)
+	VerifySecondFactor(req model.MfaVerifyRequest) (*domain.Login, *domain.MfaChallengeClaims, *errs.AppError)
+	LoginFromAccessToken(accessToken string) (*domain.Login, *errs.AppError)
+	IssueTokens(claims authz.AccessTokenClaims, owner string, familyId string, refreshTTL time.Duration) (*model.LoginResponse, *errs.AppError)
+	AddIdToken(response *model.LoginResponse, claims domain.IdTokenClaims, req model.LoginRequest) (*model.LoginResponse, *errs.AppError)
+	RotateRefreshToken(refreshToken string, accessTTL time.Duration, refreshTTL time.Duration) (*model.LoginResponse, *errs.AppError)
+	CheckNotRevoked(claims *authz.AccessTokenClaims) *errs.AppError
+	Authorize(claims *authz.AccessTokenClaims, request model.VerifyRequest, trace *authz.DecisionTrace) *errs.AppError
+}
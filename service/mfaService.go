@@ -0,0 +1,238 @@
+package service
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/domain"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+)
+
+type MfaService interface {
+	EnrollTotp(accessToken string) (*model.TotpEnrollmentResponse, *errs.AppError)
+	ConfirmTotp(accessToken string, request model.TotpConfirmRequest) (*model.TotpConfirmResponse, *errs.AppError)
+	Verify(request model.MfaVerifyRequest) (*model.LoginResponse, *errs.AppError)
+}
+
+type DefaultMfaService struct {
+	logins     LoginFlow
+	repo       domain.MfaRepository
+	issuerName string
+}
+
+/*
+EnrollTotp starts the TOTP enrollment of the user the access token belongs
+to. Only users logging in with a password can enroll, and a new enrollment
+replaces one that was never confirmed.
+*/
+func (s DefaultMfaService) EnrollTotp(accessToken string) (*model.TotpEnrollmentResponse, *errs.AppError) {
+	login, appErr := s.logins.LoginFromAccessToken(accessToken)
+	if appErr != nil {
+		return nil, appErr
+	}
+	secret := domain.NewTotpSecret()
+	if appErr = s.repo.SaveTotpEnrollment(login.UserId, secret); appErr != nil {
+		return nil, appErr
+	}
+	return &model.TotpEnrollmentResponse{
+		Secret:     secret,
+		OtpauthUri: domain.TotpUri(s.issuerName, login.Username, secret),
+	}, nil
+}
+
+// ConfirmTotp activates the enrollment once the user proved the
+// authenticator app shows the right codes, and hands out the recovery codes.
+func (s DefaultMfaService) ConfirmTotp(accessToken string, request model.TotpConfirmRequest) (*model.TotpConfirmResponse, *errs.AppError) {
+	login, appErr := s.logins.LoginFromAccessToken(accessToken)
+	if appErr != nil {
+		return nil, appErr
+	}
+	enrollment, appErr := s.repo.FindTotp(login.UserId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if enrollment.Confirmed {
+		return nil, errs.NewConflictError("totp already confirmed")
+	}
+	step, ok := domain.ValidateTotp(enrollment.Secret, request.Code, time.Now(), 0)
+	if !ok {
+		return nil, errs.NewValidationError("invalid code")
+	}
+	recoveryCodes := domain.NewRecoveryCodes()
+	if appErr = s.repo.ConfirmTotp(login.UserId, step, recoveryCodes); appErr != nil {
+		return nil, appErr
+	}
+	return &model.TotpConfirmResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+// Verify completes a login waiting for the second factor.
+func (s DefaultMfaService) Verify(request model.MfaVerifyRequest) (*model.LoginResponse, *errs.AppError) {
+	login, challenge, appErr := s.logins.VerifySecondFactor(request)
+	if appErr != nil {
+		return nil, appErr
+	}
+	var response *model.LoginResponse
+	if response, appErr = s.logins.IssueTokens(login.ClaimsForAccessToken(), login.TokenOwner(), domain.NewRandomId(), domain.REFRESH_TOKEN_DURATION); appErr != nil {
+		return nil, appErr
+	}
+	return s.logins.AddIdToken(response, login.ClaimsForIdToken(), model.LoginRequest{ClientId: challenge.ClientId, Nonce: challenge.Nonce})
+}
+
+/*
+ChallengeSecondFactor returns the MFA challenge token and the second factors
+the user can answer it with: a confirmed TOTP enrollment and, for admins,
+passkeys. Nothing is returned when the first factor is enough, the login is
+complete then and the failed logins of the account are reset.
+*/
+func (s DefaultAuthService) ChallengeSecondFactor(login *domain.Login, req model.LoginRequest) (string, []string, *errs.AppError) {
+	methods := make([]string, 0)
+	enrollment, appErr := s.mfa.FindTotp(login.UserId)
+	if appErr != nil && appErr.Code != http.StatusNotFound {
+		return "", nil, appErr
+	}
+	if enrollment != nil && enrollment.Confirmed {
+		methods = append(methods, domain.LoginMethodTotp)
+	}
+	if login.HasRole(authz.AdminRole) {
+		hasPasskey, appErr := s.passkeys.HasCredentials(login.UserId)
+		if appErr != nil {
+			return "", nil, appErr
+		}
+		if hasPasskey {
+			methods = append(methods, domain.LoginMethodPasskey)
+		}
+	}
+	if len(methods) == 0 {
+		s.lockouts.Reset(login.TokenOwner())
+		return "", nil, nil
+	}
+	claims := domain.MfaChallengeClaims{Username: login.Username, ClientId: req.ClientId, Nonce: req.Nonce}
+	claims.Subject = login.TokenOwner()
+	token, appErr := s.issuer.NewMfaChallengeToken(claims)
+	if appErr != nil {
+		return "", nil, appErr
+	}
+	return token, methods, nil
+}
+
+// MfaChallenge returns the login waiting for its second factor, as long as
+// the challenge token was not used yet.
+func (s DefaultAuthService) MfaChallenge(mfaToken string) (*domain.Login, *domain.MfaChallengeClaims, *errs.AppError) {
+	challenge, err := s.validator.ValidateMfaChallengeToken(mfaToken)
+	if err != nil {
+		return nil, nil, errs.NewCodedError(http.StatusUnauthorized, "invalid_mfa_token", "invalid or expired mfa token")
+	}
+	used, appErr := s.denylist.Contains(challenge.Id)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+	if used {
+		return nil, nil, errs.NewCodedError(http.StatusUnauthorized, "invalid_mfa_token", "mfa token already used")
+	}
+	login, appErr := s.repo.FindByUsername(challenge.Username)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+	if login.TokenOwner() != challenge.Subject {
+		return nil, nil, errs.NewCodedError(http.StatusUnauthorized, "invalid_mfa_token", "invalid mfa token")
+	}
+	return login, challenge, nil
+}
+
+/*
+VerifySecondFactor checks the TOTP code, recovery code or passkey assertion
+for an MFA challenge token. The token can only complete a single login, and
+wrong codes count towards the lockout of the account like wrong passwords.
+*/
+func (s DefaultAuthService) VerifySecondFactor(req model.MfaVerifyRequest) (*domain.Login, *domain.MfaChallengeClaims, *errs.AppError) {
+	if appErr := s.rateLimiter.Allow(domain.RateLimitLoginIp, req.ClientIp); appErr != nil {
+		return nil, nil, appErr
+	}
+	login, challenge, appErr := s.MfaChallenge(req.MfaToken)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+	if appErr = s.CheckNotLockedOut(login.TokenOwner()); appErr != nil {
+		return nil, nil, appErr
+	}
+
+	failure := domain.LoginFailure{
+		Owner:   sql.NullString{String: login.TokenOwner(), Valid: true},
+		Account: login.Username,
+		Method:  domain.LoginMethodTotp,
+	}
+	loginRequest := model.LoginRequest{ClientIp: req.ClientIp, UserAgent: req.UserAgent}
+	switch {
+	case len(req.WebAuthn) > 0:
+		if !login.HasRole(authz.AdminRole) {
+			return nil, nil, errs.NewValidationError("passkeys are only a second factor for admins")
+		}
+		if _, appErr = s.passkeys.FinishLogin(domain.WebAuthnCeremonyMfa, login, req.WebAuthn, nil); appErr != nil {
+			if appErr.Code == http.StatusUnauthorized {
+				failure.Method = domain.LoginMethodPasskey
+				failure.Reason = "invalid_passkey"
+				s.recordLoginFailure(failure, loginRequest)
+			}
+			return nil, nil, appErr
+		}
+	case req.RecoveryCode != "":
+		if appErr = s.mfa.UseRecoveryCode(login.UserId, req.RecoveryCode); appErr != nil {
+			if appErr.Code == http.StatusUnauthorized {
+				failure.Reason = "invalid_recovery_code"
+				s.recordLoginFailure(failure, loginRequest)
+			}
+			return nil, nil, appErr
+		}
+	default:
+		enrollment, appErr := s.mfa.FindTotp(login.UserId)
+		if appErr != nil {
+			return nil, nil, appErr
+		}
+		step, ok := domain.ValidateTotp(enrollment.Secret, req.Code, time.Now(), enrollment.LastUsedStep)
+		if !ok {
+			failure.Reason = "invalid_totp"
+			s.recordLoginFailure(failure, loginRequest)
+			return nil, nil, errs.NewAuthenticationError("invalid code")
+		}
+		if appErr = s.mfa.UseTotpStep(login.UserId, step); appErr != nil {
+			if appErr.Code == http.StatusConflict {
+				return nil, nil, errs.NewAuthenticationError("code already used")
+			}
+			return nil, nil, appErr
+		}
+	}
+
+	if appErr = s.denylist.Add(challenge.Id, time.Unix(challenge.ExpiresAt, 0)); appErr != nil {
+		return nil, nil, appErr
+	}
+	s.lockouts.Reset(login.TokenOwner())
+	return login, challenge, nil
+}
+
+// LoginFromAccessToken returns the password login the access token was
+// issued to.
+func (s DefaultAuthService) LoginFromAccessToken(accessToken string) (*domain.Login, *errs.AppError) {
+	claims, err := s.validator.ValidateAccessToken(accessToken)
+	if err != nil {
+		return nil, errs.NewAuthenticationError("invalid token")
+	}
+	if appErr := s.CheckNotRevoked(claims); appErr != nil {
+		return nil, appErr
+	}
+	login, appErr := s.repo.FindByUsername(claims.Username)
+	if appErr != nil || strconv.FormatInt(login.UserId, 10) != claims.UserId {
+		if appErr != nil && appErr.Code != http.StatusNotFound {
+			return nil, appErr
+		}
+		return nil, errs.NewValidationError("only users logging in with a password can register an authenticator")
+	}
+	return login, nil
+}
+
+func NewMfaService(logins LoginFlow, repo domain.MfaRepository, issuerName string) DefaultMfaService {
+	return DefaultMfaService{logins, repo, issuerName}
+}
@@ -0,0 +1,531 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/domain"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+
+	"go.uber.org/zap"
+)
+
+type OAuthService interface {
+	Introspect(request model.IntrospectionRequest) (*model.IntrospectionResponse, *errs.AppError)
+	Discovery() model.DiscoveryDocument
+	UserInfo(accessToken string) (*model.UserInfoResponse, *errs.AppError)
+	ValidateAuthorizeRequest(request model.AuthorizeRequest) (*model.AuthorizeResponse, *errs.AppError)
+	Authorize(request model.AuthorizeRequest) (*model.AuthorizeResponse, *errs.AppError)
+	Token(request model.TokenRequest) (*model.TokenResponse, *errs.AppError)
+}
+
+type DefaultOAuthService struct {
+	logins    LoginFlow
+	repo      domain.AuthRepository
+	issuer    domain.TokenIssuer
+	validator domain.TokenValidator
+	clients   domain.ClientRepository
+	keys      *domain.KeyRing
+	codes     domain.AuthorizationCodeRepository
+}
+
+/*
+ValidateAuthorizeRequest checks an authorization request before the login form
+is shown. As long as the redirect URI is not known to belong to the client,
+errors are returned to be shown to the user. Once it is, errors are reported
+to the client by redirecting to it, and a nil response means the request is
+fine.
+*/
+func (s DefaultOAuthService) ValidateAuthorizeRequest(request model.AuthorizeRequest) (*model.AuthorizeResponse, *errs.AppError) {
+	client, appErr := s.clients.FindClient(request.ClientId)
+	if appErr != nil {
+		if appErr.Code != http.StatusUnauthorized {
+			return nil, appErr
+		}
+		return nil, errs.NewCodedError(http.StatusBadRequest, "invalid_client", "unknown client")
+	}
+	if !client.IsValidRedirectUri(request.RedirectUri) {
+		return nil, errs.NewCodedError(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for the client")
+	}
+
+	if !client.AllowsGrant(domain.GrantTypeAuthorizationCode) {
+		return authorizeError(request, "unauthorized_client", "the client may not use the authorization code grant"), nil
+	}
+	if !client.AllowsScope(request.Scope) {
+		return authorizeError(request, "invalid_scope", "the requested scope is not registered for the client"), nil
+	}
+
+	if request.ResponseType != "code" {
+		return authorizeError(request, "unsupported_response_type", "only the code response type is supported"), nil
+	}
+	// PKCE is mandatory for every client, public or confidential
+	if request.CodeChallengeMethod != domain.CodeChallengeMethodS256 {
+		return authorizeError(request, "invalid_request", "code_challenge_method must be S256"), nil
+	}
+	if !isValidCodeChallenge(request.CodeChallenge) {
+		return authorizeError(request, "invalid_request", "code_challenge must be the base64url encoded SHA-256 of the code verifier"), nil
+	}
+	return nil, nil
+}
+
+/*
+Authorize authenticates the user that submitted the login form and sends a
+single use authorization code to the client. Invalid credentials are
+returned as an authentication error so the form can be shown again. Users
+with a second factor submit the form twice: the password is answered with an
+MFA challenge token, which is then posted along with the code.
+*/
+func (s DefaultOAuthService) Authorize(request model.AuthorizeRequest) (*model.AuthorizeResponse, *errs.AppError) {
+	if response, appErr := s.ValidateAuthorizeRequest(request); response != nil || appErr != nil {
+		return response, appErr
+	}
+
+	var login *domain.Login
+	var appErr *errs.AppError
+	if request.MfaToken != "" {
+		mfaRequest := model.MfaVerifyRequest{
+			MfaToken:  request.MfaToken,
+			Code:      request.MfaCode,
+			ClientIp:  request.ClientIp,
+			UserAgent: request.UserAgent,
+		}
+		if login, _, appErr = s.logins.VerifySecondFactor(mfaRequest); appErr != nil {
+			return nil, appErr
+		}
+	} else {
+		if login, appErr = s.logins.Authenticate(request.AsLoginRequest()); appErr != nil {
+			return nil, appErr
+		}
+		mfaToken, _, appErr := s.logins.ChallengeSecondFactor(login, request.AsLoginRequest())
+		if appErr != nil {
+			return nil, appErr
+		}
+		if mfaToken != "" {
+			return &model.AuthorizeResponse{MfaToken: mfaToken}, nil
+		}
+	}
+
+	code := domain.NewRandomId() + domain.NewRandomId()
+	now := time.Now()
+	authorizationCode := domain.AuthorizationCode{
+		CodeHash:      domain.HashAuthorizationCode(code),
+		ClientId:      request.ClientId,
+		RedirectUri:   request.RedirectUri,
+		Username:      login.Username,
+		Scope:         request.Scope,
+		Nonce:         request.Nonce,
+		CodeChallenge: request.CodeChallenge,
+		AuthTime:      now,
+		ExpiresOn:     now.Add(domain.AUTHORIZATION_CODE_DURATION),
+	}
+	if appErr = s.codes.Save(authorizationCode); appErr != nil {
+		return nil, appErr
+	}
+
+	params := url.Values{"code": {code}}
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	return &model.AuthorizeResponse{RedirectUri: withQuery(request.RedirectUri, params)}, nil
+}
+
+func (s DefaultOAuthService) Token(request model.TokenRequest) (*model.TokenResponse, *errs.AppError) {
+	client, appErr := s.authenticateTokenClient(request.ClientId, request.ClientSecret)
+	if appErr != nil {
+		return nil, appErr
+	}
+	switch request.GrantType {
+	case domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken, domain.GrantTypeClientCredentials:
+		if !client.AllowsGrant(request.GrantType) {
+			return nil, errs.NewCodedError(http.StatusBadRequest, "unauthorized_client", "the client may not use the "+request.GrantType+" grant")
+		}
+	default:
+		return nil, errs.NewCodedError(http.StatusBadRequest, "unsupported_grant_type", "unsupported grant type "+request.GrantType)
+	}
+
+	switch request.GrantType {
+	case domain.GrantTypeAuthorizationCode:
+		return s.exchangeAuthorizationCode(client, request)
+	case domain.GrantTypeRefreshToken:
+		return s.refreshTokenGrant(client, request)
+	default:
+		return s.clientCredentialsGrant(client, request)
+	}
+}
+
+/*
+exchangeAuthorizationCode redeems a code for the tokens of the user that
+logged in. The code is only redeemed by the client it was issued to, with the
+redirect_uri and the PKCE verifier of the authorization request. A code
+redeemed twice that way has leaked, so the token family issued for it the
+first time is revoked, as RFC 6749 section 4.1.2 asks.
+*/
+func (s DefaultOAuthService) exchangeAuthorizationCode(client *domain.Client, request model.TokenRequest) (*model.TokenResponse, *errs.AppError) {
+	familyId := domain.NewRandomId()
+	code, appErr := s.codes.Consume(domain.HashAuthorizationCode(request.Code), familyId, func(code domain.AuthorizationCode) *errs.AppError {
+		return verifyAuthorizationCode(code, client, request)
+	})
+	if appErr != nil {
+		switch appErr.Code {
+		case http.StatusConflict:
+			logger.Warn("Security event: authorization code replayed, revoking the tokens issued for it",
+				zap.String("event", "authorization_code_reuse"),
+				zap.String("client_id", client.ClientId),
+				zap.String("family_id", code.FamilyId.String))
+			if code.FamilyId.Valid {
+				if revokeErr := s.repo.RevokeRefreshTokenFamily(code.FamilyId.String); revokeErr != nil {
+					return nil, revokeErr
+				}
+			}
+			return nil, errs.NewCodedError(http.StatusBadRequest, "invalid_grant", appErr.Message)
+		case http.StatusUnauthorized:
+			return nil, errs.NewCodedError(http.StatusBadRequest, "invalid_grant", appErr.Message)
+		}
+		return nil, appErr
+	}
+	login, appErr := s.repo.FindByUsername(code.Username)
+	if appErr != nil {
+		return nil, appErr
+	}
+	claims := login.ClaimsForAccessToken()
+	claims.ClientId = client.ClientId
+	claims.Scope = code.Scope
+	claims.ExpiresAt = time.Now().Add(client.AccessTokenDuration()).Unix()
+	tokens, appErr := s.logins.IssueTokens(claims, login.TokenOwner(), familyId, client.RefreshTokenDuration())
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if code.HasScope("openid") {
+		idClaims := login.ClaimsForIdToken()
+		idClaims.Audience = client.ClientId
+		idClaims.Nonce = code.Nonce
+		idClaims.AuthTime = code.AuthTime.Unix()
+		if tokens.IdToken, appErr = s.issuer.NewIdToken(idClaims); appErr != nil {
+			return nil, appErr
+		}
+	}
+	return tokenResponse(tokens, code.Scope), nil
+}
+
+// verifyAuthorizationCode checks that the token request was made by the
+// client the code was issued to, for the authorization request it was issued
+// for.
+func verifyAuthorizationCode(code domain.AuthorizationCode, client *domain.Client, request model.TokenRequest) *errs.AppError {
+	if code.ClientId != client.ClientId {
+		return errs.NewCodedError(http.StatusBadRequest, "invalid_grant", "authorization code was issued to another client")
+	}
+	if code.RedirectUri != request.RedirectUri {
+		return errs.NewCodedError(http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+	}
+	if code.IsExpired() {
+		return errs.NewCodedError(http.StatusBadRequest, "invalid_grant", "authorization code expired")
+	}
+	if !code.IsValidCodeVerifier(request.CodeVerifier) {
+		return errs.NewCodedError(http.StatusBadRequest, "invalid_grant", "invalid code_verifier")
+	}
+	return nil
+}
+
+func (s DefaultOAuthService) refreshTokenGrant(client *domain.Client, request model.TokenRequest) (*model.TokenResponse, *errs.AppError) {
+	claims, err := s.validator.ValidateRefreshToken(request.RefreshToken)
+	if err != nil {
+		return nil, errs.NewCodedError(http.StatusBadRequest, "invalid_grant", "invalid or expired refresh token")
+	}
+	// tokens of direct logins, without a client, are refreshed at /auth/refresh
+	if claims.ClientId != client.ClientId {
+		return nil, errs.NewCodedError(http.StatusBadRequest, "invalid_grant", "refresh token was issued to another client")
+	}
+	tokens, appErr := s.logins.RotateRefreshToken(request.RefreshToken, client.AccessTokenDuration(), client.RefreshTokenDuration())
+	if appErr != nil {
+		if appErr.Code == http.StatusUnauthorized {
+			return nil, errs.NewCodedError(http.StatusBadRequest, "invalid_grant", appErr.Message)
+		}
+		return nil, appErr
+	}
+	return tokenResponse(tokens, claims.Scope), nil
+}
+
+/*
+clientCredentialsGrant issues an access token to a confidential client acting
+as itself, e.g. a backend job. The token carries the client's role so routes
+are authorized like for any other principal. No refresh token is issued, the
+client can simply authenticate again.
+*/
+func (s DefaultOAuthService) clientCredentialsGrant(client *domain.Client, request model.TokenRequest) (*model.TokenResponse, *errs.AppError) {
+	if client.IsPublic() {
+		return nil, errs.NewCodedError(http.StatusBadRequest, "unauthorized_client", "public clients may not use the client_credentials grant")
+	}
+	scope := request.Scope
+	if scope == "" {
+		scope = strings.Join(client.Scopes, " ")
+	} else if !client.AllowsScope(scope) {
+		return nil, errs.NewCodedError(http.StatusBadRequest, "invalid_scope", "the requested scope is not registered for the client")
+	}
+
+	accessToken, appErr := s.issuer.NewAccessToken(client.ClaimsForAccessToken(scope))
+	if appErr != nil {
+		return nil, appErr
+	}
+	return &model.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(client.AccessTokenDuration().Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// authenticateTokenClient requires the secret of confidential clients, public
+// clients are identified by their client_id and bound to the code by PKCE.
+func (s DefaultOAuthService) authenticateTokenClient(clientId string, clientSecret string) (*domain.Client, *errs.AppError) {
+	client, appErr := s.clients.FindClient(clientId)
+	if appErr != nil && appErr.Code != http.StatusUnauthorized {
+		return nil, appErr
+	}
+	if appErr != nil || (!client.IsPublic() && !client.VerifySecret(clientSecret)) {
+		return nil, errs.NewCodedError(http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+	}
+	return client, nil
+}
+
+func (s DefaultOAuthService) Discovery() model.DiscoveryDocument {
+	issuer := s.issuer.Issuer()
+	return model.DiscoveryDocument{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/userinfo",
+		JwksUri:                           issuer + "/.well-known/jwks.json",
+		RevocationEndpoint:                issuer + "/auth/revoke",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		ScopesSupported:                   []string{"openid", "phone"},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken, domain.GrantTypeClientCredentials},
+		CodeChallengeMethodsSupported:     []string{domain.CodeChallengeMethodS256},
+		SubjectTypesSupported:             []string{"public"},
+		IdTokenSigningAlgValuesSupported:  []string{s.keys.Signer().Method().Alg()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		ClaimsSupported: []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"preferred_username", "phone_number", "phone_number_verified"},
+	}
+}
+
+/*
+UserInfo returns the standard claims of the user the access token was issued
+to, looked up in the table its subject names. Principals removed since the
+token was issued only get the claims the token carries, client credentials
+tokens are refused as they were issued to no user.
+*/
+func (s DefaultOAuthService) UserInfo(accessToken string) (*model.UserInfoResponse, *errs.AppError) {
+	claims, err := jwtTokenFromString(accessToken, s.validator)
+	if err != nil {
+		return nil, errs.NewAuthenticationError("invalid token")
+	}
+	if appErr := s.logins.CheckNotRevoked(claims); appErr != nil {
+		if appErr.Code == http.StatusForbidden {
+			return nil, errs.NewAuthenticationError(appErr.Message)
+		}
+		return nil, appErr
+	}
+	if strings.HasPrefix(claims.Subject, domain.ClientSubjectPrefix) {
+		return nil, errs.NewAuthenticationError("client tokens have no userinfo")
+	}
+
+	idClaims, appErr := s.idTokenClaims(claims.Subject)
+	if appErr != nil {
+		if appErr.Code != http.StatusNotFound {
+			return nil, appErr
+		}
+		return &model.UserInfoResponse{Sub: claims.Subject, PreferredUsername: claims.Username}, nil
+	}
+	if idClaims.PreferredUsername == "" {
+		idClaims.PreferredUsername = claims.Username
+	}
+	return &model.UserInfoResponse{
+		Sub:                 idClaims.Subject,
+		PreferredUsername:   idClaims.PreferredUsername,
+		PhoneNumber:         idClaims.PhoneNumber,
+		PhoneNumberVerified: idClaims.PhoneNumberVerified,
+	}, nil
+}
+
+// idTokenClaims describes the user a subject names, the password login of a
+// "users:<id>" subject or the OTP user of a "sanyukt_users:<id>" one.
+func (s DefaultOAuthService) idTokenClaims(subject string) (*domain.IdTokenClaims, *errs.AppError) {
+	owner, id, _ := strings.Cut(subject, ":")
+	userId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, errs.NewAuthenticationError("invalid token subject")
+	}
+	switch owner {
+	case domain.TokenOwnerLogin:
+		login, appErr := s.repo.FindLoginById(userId)
+		if appErr != nil {
+			return nil, appErr
+		}
+		idClaims := login.ClaimsForIdToken()
+		return &idClaims, nil
+	case domain.TokenOwnerUser:
+		user, appErr := s.repo.FindUserById(id)
+		if appErr != nil {
+			return nil, appErr
+		}
+		idClaims := user.ClaimsForIdToken(user.OtpVerified.Bool)
+		return &idClaims, nil
+	}
+	return nil, errs.NewAuthenticationError("invalid token subject")
+}
+
+/*
+Introspect implements RFC 7662 for authenticated clients. The token is active
+when it verifies and is neither denylisted nor, for refresh tokens, revoked or
+rotated in the store.
+*/
+func (s DefaultOAuthService) Introspect(request model.IntrospectionRequest) (*model.IntrospectionResponse, *errs.AppError) {
+	if _, appErr := s.authenticateClient(request.ClientId, request.ClientSecret); appErr != nil {
+		return nil, appErr
+	}
+	if request.Token == "" {
+		return nil, errs.NewValidationError("missing token")
+	}
+
+	if request.TokenTypeHint == authz.TokenTypeRefresh {
+		if response, appErr := s.introspectRefreshToken(request.Token); response != nil || appErr != nil {
+			return response, appErr
+		}
+		return s.introspectAccessToken(request.Token)
+	}
+	if response, appErr := s.introspectAccessToken(request.Token); appErr != nil || response.Active {
+		return response, appErr
+	}
+	if response, appErr := s.introspectRefreshToken(request.Token); response != nil || appErr != nil {
+		return response, appErr
+	}
+	return &model.IntrospectionResponse{Active: false}, nil
+}
+
+func (s DefaultOAuthService) introspectAccessToken(token string) (*model.IntrospectionResponse, *errs.AppError) {
+	claims, err := jwtTokenFromString(token, s.validator)
+	if err != nil {
+		return &model.IntrospectionResponse{Active: false}, nil
+	}
+	if appErr := s.logins.CheckNotRevoked(claims); appErr != nil {
+		if appErr.Code == http.StatusForbidden {
+			return &model.IntrospectionResponse{Active: false}, nil
+		}
+		return nil, appErr
+	}
+	return &model.IntrospectionResponse{
+		Active:     true,
+		Sub:        claims.Subject,
+		Username:   claims.Username,
+		Scope:      claims.Scope,
+		Exp:        claims.ExpiresAt,
+		Iat:        claims.IssuedAt,
+		Jti:        claims.Id,
+		Role:       claims.Role,
+		Roles:      claims.Roles,
+		CustomerId: claims.CustomerId,
+		Accounts:   claims.Accounts,
+		TokenType:  authz.TokenTypeAccess,
+	}, nil
+}
+
+// introspectRefreshToken returns nil when the token is no refresh token at all.
+func (s DefaultOAuthService) introspectRefreshToken(token string) (*model.IntrospectionResponse, *errs.AppError) {
+	claims, err := s.validator.ValidateRefreshToken(token)
+	if err != nil {
+		return nil, nil
+	}
+	record, appErr := s.repo.FindRefreshToken(token)
+	if appErr != nil {
+		if appErr.Code == http.StatusUnauthorized {
+			return &model.IntrospectionResponse{Active: false}, nil
+		}
+		return nil, appErr
+	}
+	if record.Status != domain.RefreshTokenActive {
+		return &model.IntrospectionResponse{Active: false}, nil
+	}
+	return &model.IntrospectionResponse{
+		Active:     true,
+		Sub:        claims.Subject,
+		Username:   claims.Username,
+		Scope:      claims.Scope,
+		Exp:        claims.ExpiresAt,
+		Iat:        claims.IssuedAt,
+		Jti:        claims.Id,
+		Role:       claims.Role,
+		Roles:      claims.Roles,
+		CustomerId: claims.CustomerId,
+		Accounts:   claims.Accounts,
+		TokenType:  authz.TokenTypeRefresh,
+	}, nil
+}
+
+func (s DefaultOAuthService) authenticateClient(clientId string, clientSecret string) (*domain.Client, *errs.AppError) {
+	if clientId == "" {
+		return nil, errs.NewAuthenticationError("client authentication required")
+	}
+	client, appErr := s.clients.FindClient(clientId)
+	if appErr != nil {
+		if appErr.Code != http.StatusUnauthorized {
+			return nil, appErr
+		}
+		return nil, errs.NewAuthenticationError("invalid client credentials")
+	}
+	// public clients can not keep a secret, so they can not authenticate here
+	if client.IsPublic() || !client.VerifySecret(clientSecret) {
+		return nil, errs.NewAuthenticationError("invalid client credentials")
+	}
+	return client, nil
+}
+
+func authorizeError(request model.AuthorizeRequest, errorCode string, description string) *model.AuthorizeResponse {
+	params := url.Values{"error": {errorCode}, "error_description": {description}}
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	return &model.AuthorizeResponse{RedirectUri: withQuery(request.RedirectUri, params)}
+}
+
+func withQuery(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func isValidCodeChallenge(challenge string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(b) == sha256.Size
+}
+
+func tokenResponse(tokens *model.LoginResponse, scope string) *model.TokenResponse {
+	return &model.TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(domain.ACCESS_TOKEN_DURATION.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		IdToken:      tokens.IdToken,
+		Scope:        scope,
+	}
+}
+
+func NewOAuthService(logins LoginFlow, repo domain.AuthRepository, issuer domain.TokenIssuer, validator domain.TokenValidator, clients domain.ClientRepository, keys *domain.KeyRing, codes domain.AuthorizationCodeRepository) DefaultOAuthService {
+	return DefaultOAuthService{logins, repo, issuer, validator, clients, keys, codes}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+)
+
+type PolicyService interface {
+	Evaluate(request model.PolicyEvaluateRequest) (*model.DecisionResponse, *errs.AppError)
+}
+
+type DefaultPolicyService struct {
+	logins LoginFlow
+}
+
+// Evaluate decides on a request made with the given claims, skipping the
+// token checks, and explains the decision.
+func (s DefaultPolicyService) Evaluate(request model.PolicyEvaluateRequest) (*model.DecisionResponse, *errs.AppError) {
+	trace := &authz.DecisionTrace{}
+	trace.Add("token", request.Claims.Subject, authz.TraceSkip, "claims supplied by the caller")
+	claims := request.Claims
+	return decisionResponse(s.logins.Authorize(&claims, request.AsVerifyRequest(), trace), trace)
+}
+
+// Explain makes the same decision as Verify and returns it with its trace.
+// Only unexpected errors are returned as errors, denials are decisions.
+func (s DefaultAuthService) Explain(request model.VerifyRequest) (*model.DecisionResponse, *errs.AppError) {
+	trace := &authz.DecisionTrace{}
+	_, appErr := s.verify(request, trace)
+	return decisionResponse(appErr, trace)
+}
+
+func decisionResponse(appErr *errs.AppError, trace *authz.DecisionTrace) (*model.DecisionResponse, *errs.AppError) {
+	if appErr == nil {
+		return &model.DecisionResponse{IsAuthorized: true, Trace: trace.Steps}, nil
+	}
+	if appErr.Code != http.StatusUnauthorized && appErr.Code != http.StatusForbidden {
+		return nil, appErr
+	}
+	return &model.DecisionResponse{IsAuthorized: false, Message: appErr.Message, Trace: trace.Steps}, nil
+}
+
+func NewPolicyService(logins LoginFlow) DefaultPolicyService {
+	return DefaultPolicyService{logins}
+}
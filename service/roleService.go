@@ -0,0 +1,160 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/domain"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/logger"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+)
+
+type RoleService interface {
+	FindAll() ([]model.RoleResponse, *errs.AppError)
+	Find(name string) (*model.RoleResponse, *errs.AppError)
+	Save(name string, request model.RoleRequest) (*model.RoleResponse, *errs.AppError)
+	Delete(name string) *errs.AppError
+	Reload() *errs.AppError
+}
+
+type DefaultRoleService struct {
+	repo        domain.RoleRepository
+	permissions *authz.RolePermissions
+	routeNames  []string
+}
+
+func (s DefaultRoleService) FindAll() ([]model.RoleResponse, *errs.AppError) {
+	roles, appErr := s.repo.FindAll()
+	if appErr != nil {
+		return nil, appErr
+	}
+	response := make([]model.RoleResponse, len(roles))
+	for i, r := range roles {
+		response[i] = roleResponse(r)
+	}
+	return response, nil
+}
+
+func (s DefaultRoleService) Find(name string) (*model.RoleResponse, *errs.AppError) {
+	roles, appErr := s.repo.FindAll()
+	if appErr != nil {
+		return nil, appErr
+	}
+	for _, r := range roles {
+		if r.Name == name {
+			response := roleResponse(r)
+			return &response, nil
+		}
+	}
+	return nil, errs.NewNotFoundError("role not found")
+}
+
+/*
+Save creates or replaces the role and reloads the permissions, other
+instances pick the change up with their next scheduled reload. The inherited
+roles must exist without forming a cycle, and the admin role has to keep the
+permission to manage roles, so it can not lock itself out.
+*/
+func (s DefaultRoleService) Save(name string, request model.RoleRequest) (*model.RoleResponse, *errs.AppError) {
+	role := authz.Role{Name: name, Description: request.Description, Permissions: request.Permissions, Denies: request.Denies, Inherits: request.Inherits}
+	if appErr := role.Validate(s.routeNames); appErr != nil {
+		return nil, appErr
+	}
+	roles, appErr := s.repo.FindAll()
+	if appErr != nil {
+		return nil, appErr
+	}
+	roles = replaceRole(roles, role)
+	if appErr = authz.CheckRoleHierarchy(roles); appErr != nil {
+		return nil, appErr
+	}
+	if !authz.NewRolePermissions(roles).IsAuthorizedFor([]string{authz.AdminRole}, "ManageRoles") {
+		return nil, errs.NewValidationError("the admin role must keep the ManageRoles permission")
+	}
+	if appErr = s.repo.Save(role); appErr != nil {
+		return nil, appErr
+	}
+	logger.Info(fmt.Sprintf("Saved role %s with permissions %v", role.Name, role.Permissions))
+	if appErr := s.Reload(); appErr != nil {
+		return nil, appErr
+	}
+	response := roleResponse(role)
+	return &response, nil
+}
+
+// Delete removes a role that is no longer assigned, the built in roles are
+// kept.
+func (s DefaultRoleService) Delete(name string) *errs.AppError {
+	switch name {
+	case authz.AdminRole, authz.DefaultUserRole, authz.ClientRole:
+		return errs.NewValidationError("built in roles can not be deleted")
+	}
+	if appErr := s.repo.Delete(name); appErr != nil {
+		return appErr
+	}
+	logger.Info("Deleted role " + name)
+	return s.Reload()
+}
+
+// Reload refreshes the permissions from the store.
+func (s DefaultRoleService) Reload() *errs.AppError {
+	roles, appErr := s.repo.FindAll()
+	if appErr != nil {
+		return appErr
+	}
+	s.permissions.Load(roles)
+	return nil
+}
+
+// ScheduleReload reloads the permissions every interval, picking up changes
+// made through other instances or directly in the tables.
+func (s DefaultRoleService) ScheduleReload(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if appErr := s.Reload(); appErr != nil {
+				logger.Error("Error while reloading role permissions: " + appErr.Message)
+			}
+		}
+	}()
+}
+
+func (s DefaultRoleService) Permissions() *authz.RolePermissions {
+	return s.permissions
+}
+
+func roleResponse(r authz.Role) model.RoleResponse {
+	return model.RoleResponse{Role: r.Name, Description: r.Description, Permissions: r.Permissions, Denies: r.Denies, Inherits: r.Inherits}
+}
+
+func replaceRole(roles []authz.Role, role authz.Role) []authz.Role {
+	for i, r := range roles {
+		if r.Name == role.Name {
+			roles[i] = role
+			return roles
+		}
+	}
+	return append(roles, role)
+}
+
+/*
+NewRoleService loads the permissions from the store. On first start the
+store is empty and the default roles are persisted instead.
+*/
+func NewRoleService(repo domain.RoleRepository, routeNames []string) (DefaultRoleService, *errs.AppError) {
+	s := DefaultRoleService{repo, authz.NewRolePermissions(nil), routeNames}
+	roles, appErr := repo.FindAll()
+	if appErr != nil {
+		return s, appErr
+	}
+	if len(roles) == 0 {
+		for _, r := range authz.DefaultRoles() {
+			if appErr = repo.Save(r); appErr != nil {
+				return s, appErr
+			}
+		}
+	}
+	return s, s.Reload()
+}
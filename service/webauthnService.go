@@ -0,0 +1,104 @@
+package service
+
+import (
+	"github.com/harishkokcha91/sanyuktgolang/authz"
+	"github.com/harishkokcha91/sanyuktgolang/domain"
+	"github.com/harishkokcha91/sanyuktgolang/errs"
+	"github.com/harishkokcha91/sanyuktgolang/model"
+
+	"github.com/go-webauthn/webauthn/protocol"
+)
+
+type WebAuthnService interface {
+	BeginRegistration(accessToken string) (*protocol.CredentialCreation, *errs.AppError)
+	FinishRegistration(accessToken string, response []byte) (*model.WebAuthnCredentialResponse, *errs.AppError)
+	BeginLogin() (*protocol.CredentialAssertion, *errs.AppError)
+	FinishLogin(request model.WebAuthnLoginRequest) (*model.LoginResponse, *errs.AppError)
+	BeginSecondFactor(request model.MfaVerifyRequest) (*protocol.CredentialAssertion, *errs.AppError)
+}
+
+type DefaultWebAuthnService struct {
+	logins      LoginFlow
+	repo        domain.AuthRepository
+	rateLimiter domain.RateLimiter
+	passkeys    domain.WebAuthnRelyingParty
+}
+
+// BeginRegistration starts registering a passkey for the user the access
+// token was issued to.
+func (s DefaultWebAuthnService) BeginRegistration(accessToken string) (*protocol.CredentialCreation, *errs.AppError) {
+	login, appErr := s.logins.LoginFromAccessToken(accessToken)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return s.passkeys.BeginRegistration(login)
+}
+
+func (s DefaultWebAuthnService) FinishRegistration(accessToken string, response []byte) (*model.WebAuthnCredentialResponse, *errs.AppError) {
+	login, appErr := s.logins.LoginFromAccessToken(accessToken)
+	if appErr != nil {
+		return nil, appErr
+	}
+	credential, appErr := s.passkeys.FinishRegistration(login, response)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return &model.WebAuthnCredentialResponse{
+		CredentialId:    credential.CredentialId,
+		AttestationType: credential.AttestationType,
+		BackupEligible:  credential.BackupEligible,
+		BackupState:     credential.BackupState,
+	}, nil
+}
+
+// BeginLogin starts a passwordless login, the browser offers the passkeys it
+// has for the server.
+func (s DefaultWebAuthnService) BeginLogin() (*protocol.CredentialAssertion, *errs.AppError) {
+	return s.passkeys.BeginLogin(domain.WebAuthnCeremonyLogin, nil)
+}
+
+/*
+FinishLogin completes a passwordless login and issues the same tokens as a
+password login. A passkey proves possession and, with the user verification
+the relying party requires for it, the user itself, so no second factor is
+asked for. Locked accounts stay locked.
+*/
+func (s DefaultWebAuthnService) FinishLogin(request model.WebAuthnLoginRequest) (*model.LoginResponse, *errs.AppError) {
+	if appErr := s.rateLimiter.Allow(domain.RateLimitLoginIp, request.ClientIp); appErr != nil {
+		return nil, appErr
+	}
+	userId, appErr := s.passkeys.FinishLogin(domain.WebAuthnCeremonyLogin, nil, request.Credential, s.repo.FindLoginById)
+	if appErr != nil {
+		return nil, appErr
+	}
+	login, appErr := s.repo.FindLoginById(userId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if appErr = s.logins.CheckNotLockedOut(login.TokenOwner()); appErr != nil {
+		return nil, appErr
+	}
+
+	var response *model.LoginResponse
+	if response, appErr = s.logins.IssueTokens(login.ClaimsForAccessToken(), login.TokenOwner(), domain.NewRandomId(), domain.REFRESH_TOKEN_DURATION); appErr != nil {
+		return nil, appErr
+	}
+	return s.logins.AddIdToken(response, login.ClaimsForIdToken(), model.LoginRequest{ClientId: request.ClientId, Nonce: request.Nonce})
+}
+
+// BeginSecondFactor starts the assertion of an admin answering an MFA
+// challenge with a passkey, the result is posted to the MFA verify endpoint.
+func (s DefaultWebAuthnService) BeginSecondFactor(request model.MfaVerifyRequest) (*protocol.CredentialAssertion, *errs.AppError) {
+	login, _, appErr := s.logins.MfaChallenge(request.MfaToken)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if !login.HasRole(authz.AdminRole) {
+		return nil, errs.NewValidationError("passkeys are only a second factor for admins")
+	}
+	return s.passkeys.BeginLogin(domain.WebAuthnCeremonyMfa, login)
+}
+
+func NewWebAuthnService(logins LoginFlow, repo domain.AuthRepository, rateLimiter domain.RateLimiter, passkeys domain.WebAuthnRelyingParty) DefaultWebAuthnService {
+	return DefaultWebAuthnService{logins, repo, rateLimiter, passkeys}
+}
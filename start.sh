@@ -6,4 +6,9 @@ DB_PASSWD=qwerty@123 \
 DB_ADDR=localhost \
 DB_PORT=3306 \
 DB_NAME=sanyukt_db \
+JWT_SIGNING_ALG=HS256 \
+JWT_KEY_ENCRYPTION_KEY=dev-signing-key-encryption-key \
+OTP_PEPPER=dev-otp-pepper \
+OTP_CHANNEL=log \
+MFA_SECRET_KEY=dev-mfa-secret-key \
 go run main.go
\ No newline at end of file